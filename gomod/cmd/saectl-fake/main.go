@@ -0,0 +1,86 @@
+// saectl-fake serves an in-memory SAE endpoint for offline development:
+//
+//	saectl-fake --listen 127.0.0.1:8765 -f testdata/
+//	saectl --server=http://127.0.0.1:8765 --access-key-id=fake --access-key-secret=fake get deployments
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/component-base/cli"
+	kubectlutil "k8s.io/kubectl/pkg/cmd/util"
+
+	"saectl/pkg/proxy/fake"
+)
+
+func main() {
+	var (
+		listen             = "127.0.0.1:8765"
+		filenames          []string
+		disableCompression bool
+	)
+	command := &cobra.Command{
+		Use:   "saectl-fake [--listen=ADDRESS] [-f FILENAME]",
+		Short: "Serve an in-memory SAE endpoint",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s := fake.NewServer()
+			s.DisableCompression = disableCompression
+			for _, filename := range filenames {
+				if err := load(s, filename); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("Serving on http://%s\n", listen)
+			return http.ListenAndServe(listen, s)
+		},
+	}
+	command.Flags().StringVar(&listen, "listen", listen, "The address to listen on")
+	command.Flags().StringArrayVarP(&filenames, "filename", "f", filenames, "Manifests or directories of manifests to start with")
+	command.Flags().BoolVar(&disableCompression, "disable-compression", disableCompression, "Serve like an endpoint unaware of compressed envelopes")
+	if err := cli.RunNoErrOutput(command); err != nil {
+		kubectlutil.CheckErr(err)
+	}
+}
+
+func load(s *fake.Server, filename string) error {
+	return filepath.Walk(filename, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+		for {
+			doc, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("fail to read %s: %v", path, err)
+			}
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+			obj, _, err := clientgoscheme.Codecs.UniversalDeserializer().Decode(doc, nil, nil)
+			if err != nil {
+				return fmt.Errorf("fail to decode %s: %v", path, err)
+			}
+			if err = s.Add(obj); err != nil {
+				return fmt.Errorf("fail to add %s: %v", path, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,191 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/klog/v2"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	"saectl/pkg/proxy"
+)
+
+var (
+	auditLong = templates.LongDesc(i18n.T(`
+		Query the local audit log of mutating requests.
+
+		Every create, update, patch and delete sent to SAE is recorded with the invoking
+		command, the workstation user, the account and region, the resource, the HTTP
+		status and the POP RequestId. Values of secret flags are redacted. The log is
+		written to ~/.sae/audit.log unless --audit-log or $SAEAUDITLOG name another file,
+		--audit-syslog sends the records to the local syslog as well.`))
+
+	listLong = templates.LongDesc(i18n.T(`List the recorded requests, oldest first.`))
+
+	listExample = templates.Examples(i18n.T(help.Wrapper(`
+		# List the changes of the last day
+		%s audit list --since 24h
+
+		# List the changes to deployments as JSON lines
+		%s audit list --resource deployments -o json`, 2)))
+)
+
+// maxRecordSize bounds a line of the audit log, long argument lists make records large
+const maxRecordSize = 1 << 20
+
+func NewCmdAudit(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "audit SUBCOMMAND",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Query the audit log of mutating requests"),
+		Long:                  auditLong,
+		Run:                   cmdutil.DefaultSubCommandRun(streams.ErrOut),
+	}
+	cmd.AddCommand(NewCmdAuditList(f, streams))
+	return cmd
+}
+
+type ListOptions struct {
+	Since     time.Duration
+	Resource  string
+	Verb      string
+	NoHeaders bool
+	Output    string
+
+	filename string
+	now      time.Time
+	genericclioptions.IOStreams
+}
+
+func NewCmdAuditList(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ListOptions{IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "list [--since=DURATION] [--resource=RESOURCE] [(-o|--output=)json]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("List the recorded mutating requests"),
+		Long:                  listLong,
+		Example:               listExample,
+		Args:                  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			o.filename = f.ToAuditLog()
+			o.now = time.Now()
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().DurationVar(&o.Since, "since", o.Since, "Only list requests newer than a relative duration like 30m or 24h, defaults to all")
+	cmd.Flags().StringVar(&o.Resource, "resource", o.Resource, "Only list requests to a resource, e.g. deployments or deployments/scale")
+	cmd.Flags().StringVar(&o.Verb, "verb", o.Verb, "Only list requests of an HTTP verb, e.g. DELETE")
+	cmd.Flags().BoolVar(&o.NoHeaders, "no-headers", o.NoHeaders, "When using the default output format, don't print headers (default print headers).")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "Output format. One of: json|wide")
+	return cmd
+}
+
+func (o *ListOptions) Validate() error {
+	if len(o.filename) == 0 {
+		return errors.New("the audit log is disabled by an empty --audit-log")
+	}
+	if o.Output != "" && o.Output != "json" && o.Output != "wide" {
+		return fmt.Errorf("output must be one of '', 'json' or 'wide': %v", o.Output)
+	}
+	if o.Since < 0 {
+		return fmt.Errorf("--since must be greater than 0")
+	}
+	return nil
+}
+
+func (o *ListOptions) Run() error {
+	file, err := os.Open(o.filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("fail to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	var w io.Writer = o.Out
+	if o.Output != "json" {
+		tw := printers.GetNewTabWriter(o.Out)
+		defer tw.Flush()
+		w = tw
+		if !o.NoHeaders {
+			header := "TIME\tUSER\tVERB\tRESOURCE\tNAMESPACE\tNAME\tSTATUS\tREQUESTID"
+			if o.Output == "wide" {
+				header += "\tACCOUNT\tREGION\tHOST\tCOMMAND"
+			}
+			fmt.Fprintln(w, header)
+		}
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		record := new(proxy.AuditRecord)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			klog.Warningf("skipping line %d of %s: %v", line, o.filename, err)
+			continue
+		}
+		if !o.matches(record) {
+			continue
+		}
+		if o.Output == "json" {
+			fmt.Fprintln(w, scanner.Text())
+			continue
+		}
+		o.printRecord(w, record)
+	}
+	return scanner.Err()
+}
+
+func (o *ListOptions) matches(record *proxy.AuditRecord) bool {
+	if o.Since > 0 && record.Time.Before(o.now.Add(-o.Since)) {
+		return false
+	}
+	if len(o.Verb) != 0 && !strings.EqualFold(record.Verb, o.Verb) {
+		return false
+	}
+	if len(o.Resource) != 0 {
+		resource, subresource, _ := strings.Cut(o.Resource, "/")
+		if record.Resource != resource || (len(subresource) != 0 && record.Subresource != subresource) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *ListOptions) printRecord(w io.Writer, record *proxy.AuditRecord) {
+	resource := record.Resource
+	if len(record.Subresource) != 0 {
+		resource += "/" + record.Subresource
+	}
+	status := fmt.Sprint(record.Status)
+	if len(record.Error) != 0 {
+		status = "ERR"
+	}
+	if record.DryRun {
+		status += " (dry run)"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+		record.Time.Local().Format(time.RFC3339), record.User, record.Verb, resource, record.Namespace, record.Name, status, record.RequestId)
+	if o.Output == "wide" {
+		account := record.AccessKeyId
+		if len(record.RoleArn) != 0 {
+			account = record.RoleArn
+		}
+		fmt.Fprintf(w, "\t%s\t%s\t%s\t%s", account, record.Region, record.Host, strings.Join(append([]string{help.CommandName}, record.Args...), " "))
+	}
+	fmt.Fprintln(w)
+}
@@ -2,15 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"saectl/cmd/help"
 	soptions "saectl/internal/cmd/options"
 	"saectl/internal/cmd/version"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
 	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
 	"k8s.io/kubectl/pkg/util/i18n"
 	"k8s.io/kubectl/pkg/util/templates"
 	"k8s.io/kubectl/pkg/util/term"
@@ -18,7 +22,11 @@ import (
 	"saectl/internal/cmd/annotate"
 	"saectl/internal/cmd/apiresources"
 	"saectl/internal/cmd/apply"
+	"saectl/internal/cmd/audit"
+	"saectl/internal/cmd/config"
+	"saectl/internal/cmd/cp"
 	"saectl/internal/cmd/create"
+	"saectl/internal/cmd/credential"
 	"saectl/internal/cmd/delete"
 	"saectl/internal/cmd/describe"
 	"saectl/internal/cmd/diff"
@@ -28,6 +36,7 @@ import (
 	"saectl/internal/cmd/label"
 	"saectl/internal/cmd/logs"
 	"saectl/internal/cmd/scale"
+	"saectl/internal/cmd/serve"
 	"saectl/internal/cmd/set"
 	"saectl/internal/cmd/util"
 	"saectl/pkg/options"
@@ -55,6 +64,7 @@ func NewDefaultCommandWithArgs(o CtlOption) *cobra.Command {
 }
 
 func NewCommand(o CtlOption) *cobra.Command {
+	saeConfigFlags := options.NewConfig().WithDiscoveryBurst(100).WithDiscoveryQPS(50)
 	warningHandler := rest.NewWarningWriter(o.IOStreams.ErrOut, rest.WarningWriterOptions{Deduplicate: true, Color: term.AllowsColorOutput(o.IOStreams.ErrOut)})
 	warningsAsErrors := false
 	// Parent command to which all subcommands are added.
@@ -71,9 +81,22 @@ func NewCommand(o CtlOption) *cobra.Command {
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			rest.SetDefaultWarningHandler(warningHandler)
 			// TODO: Register Automatic Completion Plugin
+			if err := saeConfigFlags.InitTrace(); err != nil {
+				return err
+			}
+			// commands exit through CheckErr on failure, the trace of a failed command is the most wanted
+			cmdutil.BehaviorOnFatal(func(msg string, code int) {
+				if err := saeConfigFlags.FlushTrace(); err != nil {
+					klog.Warningf("fail to write trace: %v", err)
+				}
+				fatal(msg, code)
+			})
 			return nil
 		},
 		PersistentPostRunE: func(*cobra.Command, []string) error {
+			if err := saeConfigFlags.FlushTrace(); err != nil {
+				return err
+			}
 			if warningsAsErrors {
 				count := warningHandler.WarningCount()
 				switch count {
@@ -96,9 +119,9 @@ func NewCommand(o CtlOption) *cobra.Command {
 	flags := cmds.PersistentFlags()
 	flags.BoolVar(&warningsAsErrors, "warnings-as-errors", warningsAsErrors, "Treat warnings received from the server as errors and exit with a non-zero exit code")
 
-	saeConfigFlags := options.NewConfig().WithDiscoveryQPS(100).WithDiscoveryQPS(50)
 	saeConfigFlags.AddFlags(flags)
-	// TODO: add cmd header hooks to distinguish the request from sdk or ctl
+	crt := addCmdHeaderHooks(cmds, saeConfigFlags)
+	addAuditHooks(cmds, saeConfigFlags, crt, o.Arguments)
 	aliCloudFactory := util.NewAliCloudFactory(saeConfigFlags)
 	f := aliCloudFactory.NewCmdFactory()
 
@@ -131,6 +154,7 @@ func NewCommand(o CtlOption) *cobra.Command {
 				describe.NewCmdDescribe(help.CommandName, f, o.IOStreams),
 				exec.NewCmdExec(aliCloudFactory, o.IOStreams),
 				logs.NewCmdLogs(f, o.IOStreams),
+				cp.NewCmdCp(aliCloudFactory, o.IOStreams),
 			},
 		},
 		{
@@ -139,6 +163,7 @@ func NewCommand(o CtlOption) *cobra.Command {
 				diff.NewCmdDiff(f, o.IOStreams),
 				apply.NewCmdApply(help.CommandName, f, o.IOStreams),
 				//replace.NewCmdReplace(f, o.IOStreams),
+				serve.NewCmdServe(aliCloudFactory, o.IOStreams),
 			},
 		},
 		{
@@ -146,6 +171,8 @@ func NewCommand(o CtlOption) *cobra.Command {
 			Commands: []*cobra.Command{
 				label.NewCmdLabel(f, o.IOStreams),
 				annotate.NewCmdAnnotate(help.CommandName, f, o.IOStreams),
+				config.NewCmdConfig(aliCloudFactory, o.IOStreams),
+				audit.NewCmdAudit(aliCloudFactory, o.IOStreams),
 			},
 		},
 		{
@@ -163,6 +190,7 @@ func NewCommand(o CtlOption) *cobra.Command {
 
 	cmds.AddCommand(apiresources.NewCmdAPIResources(f, o.IOStreams))
 	cmds.AddCommand(soptions.NewCmdOptions(o.IOStreams.Out))
+	cmds.AddCommand(credential.NewCmdCredentialProcess(aliCloudFactory, o.IOStreams))
 	cmds.SetGlobalNormalizationFunc(cliflag.WordSepNormalizeFunc)
 
 	return cmds
@@ -171,3 +199,53 @@ func NewCommand(o CtlOption) *cobra.Command {
 func runHelp(cmd *cobra.Command, args []string) {
 	cmd.Help()
 }
+
+// addCmdHeaderHooks tags every request with the saectl command, a session id and the caller tag,
+// so requests of saectl can be told apart from other SDK clients.
+func addCmdHeaderHooks(cmds *cobra.Command, saeConfigFlags *options.Config) *options.CommandHeaderRoundTripper {
+	crt := &options.CommandHeaderRoundTripper{}
+	existingPreRunE := cmds.PersistentPreRunE
+	cmds.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		crt.ParseCommandHeaders(cmd, args)
+		return existingPreRunE(cmd, args)
+	}
+	wrapConfigFn := saeConfigFlags.WrapConfigFn
+	saeConfigFlags.WrapConfigFn = func(c *rest.Config) *rest.Config {
+		if wrapConfigFn != nil {
+			c = wrapConfigFn(c)
+		}
+		if suffix := saeConfigFlags.GetUserAgentSuffix(); suffix != "" {
+			c.UserAgent = fmt.Sprintf("%s %s", c.UserAgent, suffix)
+		}
+		c.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &options.CommandHeaderRoundTripper{Delegate: rt, Headers: crt.Headers}
+		})
+		return c
+	}
+	return crt
+}
+
+// addAuditHooks records the mutating requests of the command with the invocation and session of the command headers.
+func addAuditHooks(cmds *cobra.Command, saeConfigFlags *options.Config, crt *options.CommandHeaderRoundTripper, arguments []string) {
+	existingPreRunE := cmds.PersistentPreRunE
+	cmds.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := existingPreRunE(cmd, args); err != nil {
+			return err
+		}
+		return saeConfigFlags.InitAudit(crt.Headers[options.CommandHeader], crt.Headers[options.SessionHeader], arguments)
+	}
+}
+
+// fatal prints msg and exits like the default fatal error handler of kubectl.
+func fatal(msg string, code int) {
+	if klogV := klog.V(99); klogV.Enabled() {
+		klog.FatalDepth(2, msg)
+	}
+	if len(msg) > 0 {
+		if !strings.HasSuffix(msg, "\n") {
+			msg += "\n"
+		}
+		fmt.Fprint(os.Stderr, msg)
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+)
+
+var (
+	configLong = templates.LongDesc(i18n.T(help.Wrapper(`
+		Modify the saectl config file using subcommands like "%s config set-context my-context".
+
+		The config file holds named contexts, each binding a credentials entry to a region,
+		a default namespace and an optional endpoint. The file is located at:
+
+		1. The --saeconfig flag, if set.
+		2. The $SAECONFIG environment variable, if set.
+		3. Otherwise, ${HOME}/.sae/config is used.
+
+		Access keys, STS tokens and region given by flags or environment variables take
+		precedence over the values of the selected context. Use "%s config whoami" to find
+		out which credential source is in effect.`, 2)))
+)
+
+// NewCmdConfig creates a command object for the "config" action, and adds all child commands to it.
+func NewCmdConfig(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "config SUBCOMMAND",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Modify saectl config files"),
+		Long:                  configLong,
+		Run:                   cmdutil.DefaultSubCommandRun(streams.ErrOut),
+	}
+
+	cmd.AddCommand(NewCmdConfigView(f, streams))
+	cmd.AddCommand(NewCmdConfigGetContexts(f, streams))
+	cmd.AddCommand(NewCmdConfigUseContext(f, streams))
+	cmd.AddCommand(NewCmdConfigSetContext(f, streams))
+	cmd.AddCommand(NewCmdConfigSetCredentials(f, streams))
+	cmd.AddCommand(NewCmdConfigDeleteContext(f, streams))
+	cmd.AddCommand(NewCmdConfigWhoami(f, streams))
+	cmd.AddCommand(NewCmdConfigLogout(f, streams))
+	cmd.AddCommand(NewCmdConfigExportKubeconfig(f, streams))
+
+	return cmd
+}
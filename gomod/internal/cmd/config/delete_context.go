@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+)
+
+var (
+	deleteContextExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Delete the context for the staging account
+		%s config delete-context staging`, 1)))
+)
+
+func NewCmdConfigDeleteContext(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "delete-context NAME",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Delete the specified context from the saectl config file"),
+		Long:                  i18n.T("Delete the specified context from the saectl config file."),
+		Example:               deleteContextExample,
+		Args:                  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(deleteContext(f, streams, args[0]))
+		},
+	}
+	return cmd
+}
+
+func deleteContext(f util.AliCloudFactory, streams genericclioptions.IOStreams, name string) error {
+	access := f.ToFileAccess()
+	c, err := access.Load()
+	if err != nil {
+		return err
+	}
+	if _, _, err = c.GetContext(name); err != nil {
+		return err
+	}
+	if c.CurrentContext == name {
+		fmt.Fprint(streams.ErrOut, "warning: this removed your active context, use \"config use-context\" to select a different one\n")
+		c.CurrentContext = ""
+	}
+	delete(c.Contexts, name)
+	if err = access.Save(c); err != nil {
+		return err
+	}
+	fmt.Fprintf(streams.Out, "deleted context %s from %s\n", name, access.GetDefaultFilename())
+	return nil
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	saeconfig "saectl/pkg/config"
+)
+
+const execAPIVersion = "client.authentication.k8s.io/v1"
+
+var (
+	exportKubeconfigLong = templates.LongDesc(i18n.T(help.Wrapper(`
+		Generate a kubeconfig for the current context so other Kubernetes tools can reuse it
+		through the local gateway run by "%s serve".
+
+		The user entry of the kubeconfig runs "%s credential-process" as an exec credential
+		plugin, which resolves credentials the same way %s does and hands out the local token.
+		No secret is written to the kubeconfig. The local token is issued per context and
+		identity, it is only accepted by a gateway started with "%s serve --local-token" for the
+		same context and identity, SAE itself does not accept it. The cluster entry therefore points to the default address of "%s serve", use
+		--server to export the address given to "serve --listen". Flags selecting the identity
+		(--context, --saeconfig, --profile, --credential-source, --role-arn, ...) are passed on
+		to the plugin.
+
+		Without --output the kubeconfig is printed. With --merge the entries are merged into
+		the existing file instead of replacing it.`, 5)))
+
+	exportKubeconfigExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Print a kubeconfig for the gateway of the current context
+		%s config export-kubeconfig
+
+		# Serve the prod context and add it to the default kubeconfig of kubectl
+		%s --context=prod serve --local-token
+		%s --context=prod config export-kubeconfig --output ~/.kube/config --merge
+
+		# Export the address of a gateway listening elsewhere
+		%s --context=prod serve --listen=127.0.0.1:9001 --local-token
+		%s --context=prod --server=http://127.0.0.1:9001 config export-kubeconfig`, 5)))
+
+	// passthroughFlags select the identity and are forwarded to the credential plugin when set,
+	// secrets given by flags are deliberately left out.
+	passthroughFlags = []string{"context", "saeconfig", "profile", "credential-source", "role-arn", "role-session-name", "role-duration", "region"}
+)
+
+type ExportKubeconfigOptions struct {
+	Output  string
+	Merge   bool
+	Command string
+
+	server     string
+	pluginArgs []string
+	factory    util.AliCloudFactory
+	genericclioptions.IOStreams
+}
+
+func NewCmdConfigExportKubeconfig(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ExportKubeconfigOptions{IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "export-kubeconfig [--output=FILE] [--merge]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Generate a kubeconfig using saectl as exec credential plugin"),
+		Long:                  exportKubeconfigLong,
+		Example:               exportKubeconfigExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, cmd))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "Write the kubeconfig to this file instead of stdout")
+	cmd.Flags().BoolVar(&o.Merge, "merge", o.Merge, "Merge the entries into the existing --output file")
+	cmd.Flags().StringVar(&o.Command, "plugin-command", o.Command, "Path of the saectl binary run by the credential plugin, defaults to the running binary")
+	return cmd
+}
+
+func (o *ExportKubeconfigOptions) Complete(f util.AliCloudFactory, cmd *cobra.Command) error {
+	o.factory = f
+	if len(o.Command) == 0 {
+		command, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		o.Command = command
+	}
+	o.pluginArgs = []string{"credential-process"}
+	inherited := cmd.InheritedFlags()
+	// the local token handed out by the plugin is only accepted by saectl serve, not by the POP endpoint
+	o.server = "http://" + saeconfig.LocalGatewayAddress
+	if flag := inherited.Lookup("server"); flag != nil && flag.Changed {
+		o.server = flag.Value.String()
+	}
+	for _, name := range passthroughFlags {
+		if flag := inherited.Lookup(name); flag != nil && flag.Changed {
+			o.pluginArgs = append(o.pluginArgs, fmt.Sprintf("--%s=%s", name, flag.Value.String()))
+		}
+	}
+	// the token is scoped to the context, so the plugin keeps the exported one when the current context changes
+	if !flagChanged(inherited, "context") {
+		clientConfig, err := f.ToClientConfig()
+		if err != nil {
+			return err
+		}
+		o.pluginArgs = append(o.pluginArgs, fmt.Sprintf("--context=%s", clientConfig.CurrentContext))
+	}
+	if flagChanged(inherited, "access-key-id") || flagChanged(inherited, "access-key-secret") {
+		fmt.Fprintln(o.ErrOut, "warning: credentials given by flags are not written to the kubeconfig, the plugin resolves them from env or config files")
+	}
+	return nil
+}
+
+func flagChanged(flags *pflag.FlagSet, name string) bool {
+	flag := flags.Lookup(name)
+	return flag != nil && flag.Changed
+}
+
+func (o *ExportKubeconfigOptions) Validate() error {
+	if o.Merge && len(o.Output) == 0 {
+		return fmt.Errorf("--merge requires --output")
+	}
+	return nil
+}
+
+func (o *ExportKubeconfigOptions) Run() error {
+	clientConfig, err := o.factory.ToClientConfig()
+	if err != nil {
+		return err
+	}
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return err
+	}
+	// name the cluster after the context so that merging several contexts keeps their endpoints apart
+	name := clientConfig.CurrentContext
+	cluster := rawConfig.Clusters[clientConfig.ClusterName]
+	cluster.Server = o.server
+	rawConfig.Clusters = map[string]*clientcmdapi.Cluster{name: cluster}
+	rawConfig.Contexts[name].Cluster = name
+	rawConfig.AuthInfos[name] = &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			Command:         o.Command,
+			Args:            o.pluginArgs,
+			APIVersion:      execAPIVersion,
+			InstallHint:     fmt.Sprintf("%s is required to authenticate against SAE", help.CommandName),
+			InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+		},
+	}
+
+	if len(o.Output) == 0 {
+		data, err := clientcmd.Write(rawConfig)
+		if err != nil {
+			return err
+		}
+		_, err = o.Out.Write(data)
+		return err
+	}
+
+	out := &rawConfig
+	if o.Merge {
+		if out, err = mergeKubeconfig(o.Output, rawConfig); err != nil {
+			return err
+		}
+	}
+	if err = clientcmd.WriteToFile(*out, o.Output); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "Context %q written to %s\n", clientConfig.CurrentContext, o.Output)
+	return nil
+}
+
+// mergeKubeconfig adds the entries of in to the kubeconfig file, entries with the same name are replaced.
+func mergeKubeconfig(filename string, in clientcmdapi.Config) (*clientcmdapi.Config, error) {
+	existing, err := clientcmd.LoadFromFile(filename)
+	if os.IsNotExist(err) {
+		return &in, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, cluster := range in.Clusters {
+		existing.Clusters[name] = cluster
+	}
+	for name, authInfo := range in.AuthInfos {
+		existing.AuthInfos[name] = authInfo
+	}
+	for name, context := range in.Contexts {
+		existing.Contexts[name] = context
+	}
+	existing.CurrentContext = in.CurrentContext
+	return existing, nil
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	saeconfig "saectl/pkg/config"
+)
+
+var (
+	getContextsLong = templates.LongDesc(i18n.T(`Display one or many contexts from the saectl config file.`))
+
+	getContextsExample = templates.Examples(i18n.T(help.Wrapper(`
+		# List all the contexts in your config file
+		%s config get-contexts
+
+		# Describe one context in your config file
+		%s config get-contexts my-context`, 2)))
+)
+
+type GetContextsOptions struct {
+	NoHeaders bool
+	Output    string
+
+	contextNames []string
+	access       *saeconfig.FileAccess
+	genericclioptions.IOStreams
+}
+
+func NewCmdConfigGetContexts(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &GetContextsOptions{IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "get-contexts [(-o|--output=)name)]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Describe one or many contexts"),
+		Long:                  getContextsLong,
+		Example:               getContextsExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			o.contextNames = args
+			o.access = f.ToFileAccess()
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().BoolVar(&o.NoHeaders, "no-headers", o.NoHeaders, "When using the default or custom-column output format, don't print headers (default print headers).")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "Output format. One of: name")
+	return cmd
+}
+
+func (o *GetContextsOptions) Validate() error {
+	if o.Output != "" && o.Output != "name" {
+		return fmt.Errorf("output must be one of '' or 'name': %v", o.Output)
+	}
+	return nil
+}
+
+func (o *GetContextsOptions) Run() error {
+	c, err := o.access.Load()
+	if err != nil {
+		return err
+	}
+	names := o.contextNames
+	if len(names) == 0 {
+		for name := range c.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	if o.Output == "name" {
+		for _, name := range names {
+			if _, ok := c.Contexts[name]; !ok {
+				return fmt.Errorf("context %v not found", name)
+			}
+			fmt.Fprintln(o.Out, name)
+		}
+		return nil
+	}
+
+	w := printers.GetNewTabWriter(o.Out)
+	defer w.Flush()
+	if !o.NoHeaders {
+		fmt.Fprintln(w, "CURRENT\tNAME\tREGION\tNAMESPACE\tCREDENTIALS\tSERVER")
+	}
+	var notFound []string
+	for _, name := range names {
+		ctx, ok := c.Contexts[name]
+		if !ok {
+			notFound = append(notFound, name)
+			continue
+		}
+		current := ""
+		if c.CurrentContext == name {
+			current = "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", current, name, ctx.Region, ctx.Namespace, ctx.Credentials, ctx.Server)
+	}
+	if len(notFound) > 0 {
+		return fmt.Errorf("context(s) not found: %v", notFound)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+)
+
+var (
+	logoutLong = templates.LongDesc(i18n.T(`
+		Remove the STS sessions cached for assumed RAM roles.
+
+		The next command run with --role-arn calls AssumeRole again.`))
+
+	logoutExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Drop all cached role sessions
+		%s config logout`, 1)))
+)
+
+func NewCmdConfigLogout(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "logout",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Remove cached STS sessions of assumed roles"),
+		Long:                  logoutLong,
+		Example:               logoutExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cache := f.ToSessionCache()
+			cmdutil.CheckErr(cache.Clear())
+			fmt.Fprintf(streams.Out, "Removed cached sessions from %s\n", cache.Dir)
+		},
+	}
+	return cmd
+}
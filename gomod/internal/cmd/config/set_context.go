@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	saeconfig "saectl/pkg/config"
+)
+
+var (
+	setContextLong = templates.LongDesc(i18n.T(`
+		Set a context entry in the saectl config file.
+
+		Specifying a name that already exists will merge new fields on top of existing values for those fields.`))
+
+	setContextExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Create a context using the prod credentials in cn-hangzhou
+		%s config set-context prod --credentials=prod --region=cn-hangzhou --namespace=cn-hangzhou:demo
+
+		# Change the default namespace of the current context
+		%s config set-context --current --namespace=cn-hangzhou:test
+
+		# Allow more requests per second for bulk deployments with this context
+		%s config set-context prod --qps=50 --burst=100`, 3)))
+)
+
+type SetContextOptions struct {
+	Current     bool
+	Credentials string
+	Region      string
+	Namespace   string
+	Server      string
+	QPS         float32
+	Burst       int
+
+	name    string
+	changed func(string) bool
+	access  *saeconfig.FileAccess
+	genericclioptions.IOStreams
+}
+
+func NewCmdConfigSetContext(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &SetContextOptions{IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "set-context [NAME | --current] [--credentials=credentials_nickname] [--region=region] [--namespace=namespace] [--server=endpoint] [--qps=qps] [--burst=burst]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Set a context entry in the saectl config file"),
+		Long:                  setContextLong,
+		Example:               setContextExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, cmd, args))
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().BoolVar(&o.Current, "current", o.Current, "Modify the current context")
+	cmd.Flags().StringVar(&o.Credentials, "credentials", o.Credentials, "credentials for the context entry in the saectl config file")
+	cmd.Flags().StringVar(&o.Region, "region", o.Region, "region for the context entry in the saectl config file")
+	cmd.Flags().StringVar(&o.Namespace, "namespace", o.Namespace, "namespace for the context entry in the saectl config file")
+	cmd.Flags().StringVar(&o.Server, "server", o.Server, "endpoint for the context entry in the saectl config file")
+	cmd.Flags().Float32Var(&o.QPS, "qps", o.QPS, "default --qps for the context entry in the saectl config file, 0 unsets it")
+	cmd.Flags().IntVar(&o.Burst, "burst", o.Burst, "default --burst for the context entry in the saectl config file, 0 unsets it")
+	return cmd
+}
+
+func (o *SetContextOptions) Complete(f util.AliCloudFactory, cmd *cobra.Command, args []string) error {
+	switch {
+	case len(args) == 1 && !o.Current:
+		o.name = args[0]
+	case len(args) == 0 && o.Current:
+	default:
+		return cmdutil.UsageErrorf(cmd, "you must specify a non-empty context name or --current")
+	}
+	o.changed = cmd.Flags().Changed
+	o.access = f.ToFileAccess()
+	return nil
+}
+
+func (o *SetContextOptions) Run() error {
+	c, err := o.access.Load()
+	if err != nil {
+		return err
+	}
+	name := o.name
+	if o.Current {
+		if len(c.CurrentContext) == 0 {
+			return fmt.Errorf("no current context is set")
+		}
+		name = c.CurrentContext
+	}
+	ctx, exists := c.Contexts[name]
+	if !exists {
+		ctx = &saeconfig.Context{}
+		c.Contexts[name] = ctx
+	}
+	if o.changed("credentials") {
+		ctx.Credentials = o.Credentials
+	}
+	if o.changed("region") {
+		ctx.Region = o.Region
+	}
+	if o.changed("namespace") {
+		ctx.Namespace = o.Namespace
+	}
+	if o.changed("server") {
+		ctx.Server = o.Server
+	}
+	if o.changed("qps") {
+		ctx.QPS = o.QPS
+	}
+	if o.changed("burst") {
+		ctx.Burst = o.Burst
+	}
+	if len(c.CurrentContext) == 0 {
+		c.CurrentContext = name
+	}
+	if err = o.access.Save(c); err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(o.Out, "Context %q modified.\n", name)
+	} else {
+		fmt.Fprintf(o.Out, "Context %q created.\n", name)
+	}
+	return nil
+}
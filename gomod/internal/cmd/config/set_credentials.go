@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	saeconfig "saectl/pkg/config"
+)
+
+var (
+	setCredentialsLong = templates.LongDesc(i18n.T(`
+		Set a credentials entry in the saectl config file.
+
+		Specifying a name that already exists will merge new fields on top of existing values.
+		The config file is written with owner-only permissions since it holds secrets.
+
+		Instead of static keys, a credential helper command can be configured with --exec-command.
+		It must print a JSON object with AccessKeyId, AccessKeySecret and optionally SecurityToken
+		and Expiration (RFC 3339) on stdout; it is invoked again shortly before the expiration.
+		The target region is passed in the SAECTL_EXEC_REGION environment variable.`))
+
+	setCredentialsExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Store an access key pair as the "prod" credentials
+		%s config set-credentials prod --access-key-id=LTAI... --access-key-secret=...
+
+		# Add an STS token to the "prod" credentials
+		%s config set-credentials prod --sts-token=...
+
+		# Take the "vault" credentials from a helper command
+		%s config set-credentials vault --exec-command=vault-sae --exec-arg=read --exec-arg=sae/prod --exec-env=VAULT_ADDR=https://vault:8200`, 3)))
+)
+
+type SetCredentialsOptions struct {
+	AccessKeyId     string
+	AccessKeySecret string
+	StsToken        string
+	ExecCommand     string
+	ExecArgs        []string
+	ExecEnv         []string
+
+	name    string
+	changed func(string) bool
+	access  *saeconfig.FileAccess
+	genericclioptions.IOStreams
+}
+
+func NewCmdConfigSetCredentials(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &SetCredentialsOptions{IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "set-credentials NAME [--access-key-id=id] [--access-key-secret=secret] [--sts-token=token] [--exec-command=cmd] [--exec-arg=arg] [--exec-env=key=value]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Set a credentials entry in the saectl config file"),
+		Long:                  setCredentialsLong,
+		Example:               setCredentialsExample,
+		Args:                  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			o.name = args[0]
+			o.changed = cmd.Flags().Changed
+			o.access = f.ToFileAccess()
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVar(&o.AccessKeyId, "access-key-id", o.AccessKeyId, "Alibaba Cloud Access Key Id for the credentials entry")
+	cmd.Flags().StringVar(&o.AccessKeySecret, "access-key-secret", o.AccessKeySecret, "Alibaba Cloud Access Key Secret for the credentials entry")
+	cmd.Flags().StringVar(&o.StsToken, "sts-token", o.StsToken, "Alibaba Cloud STS Token for the credentials entry")
+	cmd.Flags().StringVar(&o.ExecCommand, "exec-command", o.ExecCommand, "Command of the credential helper for the credentials entry, an empty value removes the helper")
+	cmd.Flags().StringArrayVar(&o.ExecArgs, "exec-arg", o.ExecArgs, "Argument of the credential helper, may be repeated")
+	cmd.Flags().StringArrayVar(&o.ExecEnv, "exec-env", o.ExecEnv, "Environment variable 'key=value' of the credential helper, may be repeated")
+	return cmd
+}
+
+func (o *SetCredentialsOptions) Validate() error {
+	for _, env := range o.ExecEnv {
+		if !strings.Contains(env, "=") {
+			return fmt.Errorf("exec-env %q must be formatted as key=value", env)
+		}
+	}
+	return nil
+}
+
+func (o *SetCredentialsOptions) Run() error {
+	c, err := o.access.Load()
+	if err != nil {
+		return err
+	}
+	cred, exists := c.Credentials[o.name]
+	if !exists {
+		cred = &saeconfig.Credential{}
+		c.Credentials[o.name] = cred
+	}
+	if o.changed("access-key-id") {
+		cred.AccessKeyId = o.AccessKeyId
+	}
+	if o.changed("access-key-secret") {
+		cred.AccessKeySecret = o.AccessKeySecret
+	}
+	if o.changed("sts-token") {
+		cred.StsToken = o.StsToken
+	}
+	if err = o.applyExec(cred); err != nil {
+		return err
+	}
+	if err = o.access.Save(c); err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(o.Out, "Credentials %q modified.\n", o.name)
+	} else {
+		fmt.Fprintf(o.Out, "Credentials %q set.\n", o.name)
+	}
+	return nil
+}
+
+func (o *SetCredentialsOptions) applyExec(cred *saeconfig.Credential) error {
+	if o.changed("exec-command") {
+		if len(o.ExecCommand) == 0 {
+			cred.Exec = nil
+			return nil
+		}
+		if cred.Exec == nil {
+			cred.Exec = &saeconfig.ExecConfig{}
+		}
+		cred.Exec.Command = o.ExecCommand
+	}
+	if !o.changed("exec-arg") && !o.changed("exec-env") {
+		return nil
+	}
+	if cred.Exec == nil {
+		return fmt.Errorf("--exec-arg and --exec-env require --exec-command")
+	}
+	if o.changed("exec-arg") {
+		cred.Exec.Args = o.ExecArgs
+	}
+	if o.changed("exec-env") {
+		cred.Exec.Env = nil
+		for _, env := range o.ExecEnv {
+			kv := strings.SplitN(env, "=", 2)
+			cred.Exec.Env = append(cred.Exec.Env, saeconfig.ExecEnvVar{Name: kv[0], Value: kv[1]})
+		}
+	}
+	return nil
+}
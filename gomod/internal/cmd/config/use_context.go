@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+)
+
+var (
+	useContextExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Use the context for the production account
+		%s config use-context prod`, 1)))
+)
+
+func NewCmdConfigUseContext(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "use-context CONTEXT_NAME",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Set the current-context in the saectl config file"),
+		Aliases:               []string{"use"},
+		Long:                  i18n.T("Set the current-context in the saectl config file."),
+		Example:               useContextExample,
+		Args:                  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(useContext(f, args[0]))
+			fmt.Fprintf(streams.Out, "Switched to context %q.\n", args[0])
+		},
+	}
+	return cmd
+}
+
+func useContext(f util.AliCloudFactory, name string) error {
+	access := f.ToFileAccess()
+	c, err := access.Load()
+	if err != nil {
+		return err
+	}
+	if _, _, err = c.GetContext(name); err != nil {
+		return err
+	}
+	c.CurrentContext = name
+	return access.Save(c)
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+	"sigs.k8s.io/yaml"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	saeconfig "saectl/pkg/config"
+)
+
+var (
+	viewLong = templates.LongDesc(i18n.T(`
+		Display the saectl config file.
+
+		Secrets are masked unless --raw is given.`))
+
+	viewExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Show the config file with secrets masked
+		%s config view
+
+		# Show only the current context
+		%s config view --minify
+
+		# Show the config file including secrets, in JSON
+		%s config view --raw -o json`, 3)))
+)
+
+type ViewOptions struct {
+	Raw    bool
+	Minify bool
+	Output string
+
+	access *saeconfig.FileAccess
+	genericclioptions.IOStreams
+}
+
+func NewCmdConfigView(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ViewOptions{Output: "yaml", IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "view",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Display the saectl config file"),
+		Long:                  viewLong,
+		Example:               viewExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			o.access = f.ToFileAccess()
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().BoolVar(&o.Raw, "raw", o.Raw, "Display raw secrets instead of masking them")
+	cmd.Flags().BoolVar(&o.Minify, "minify", o.Minify, "Remove all information not used by current-context from the output")
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "Output format. One of: yaml|json")
+	return cmd
+}
+
+func (o *ViewOptions) Validate() error {
+	if o.Output != "yaml" && o.Output != "json" {
+		return fmt.Errorf("unsupported output format %q, must be one of yaml|json", o.Output)
+	}
+	return nil
+}
+
+func (o *ViewOptions) Run() error {
+	c, err := o.access.Load()
+	if err != nil {
+		return err
+	}
+	if o.Minify {
+		if c, err = minify(c); err != nil {
+			return err
+		}
+	}
+	if !o.Raw {
+		c = c.Redacted()
+	}
+	var data []byte
+	if o.Output == "json" {
+		data, err = json.MarshalIndent(c, "", "    ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(c)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = o.Out.Write(data)
+	return err
+}
+
+func minify(c *saeconfig.SAEConfig) (*saeconfig.SAEConfig, error) {
+	name, ctx, err := c.GetContext("")
+	if err != nil {
+		return nil, err
+	}
+	if ctx == nil {
+		return nil, fmt.Errorf("current-context must be set to minify")
+	}
+	out := saeconfig.NewSAEConfig()
+	out.CurrentContext = name
+	out.Contexts[name] = ctx
+	if cred, ok := c.Credentials[ctx.Credentials]; ok {
+		out.Credentials[ctx.Credentials] = cred
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	saeconfig "saectl/pkg/config"
+)
+
+var (
+	whoamiLong = templates.LongDesc(i18n.T(`
+		Print the identity saectl would use for requests.
+
+		Credentials are looked up in order from flags, environment variables, the aliyun cli
+		profile, the saectl config file, an OIDC token file, the ECS instance RAM role and a
+		credentials URI. The source which provided the credentials is printed, along with the
+		RAM role assumed on top of it when --role-arn is given.`))
+
+	whoamiExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Print which credential source is used
+		%s config whoami
+
+		# Check that the ECS instance RAM role is usable
+		%s config whoami --credential-source=ecs`, 2)))
+)
+
+func NewCmdConfigWhoami(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:                   "whoami",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Print the credential source and identity in use"),
+		Long:                  whoamiLong,
+		Example:               whoamiExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(whoami(f, streams))
+		},
+	}
+	return cmd
+}
+
+func whoami(f util.AliCloudFactory, streams genericclioptions.IOStreams) error {
+	c, err := f.ToClientConfig()
+	if err != nil {
+		return err
+	}
+	accessKeyId, err := saeconfig.CredentialAccessKeyId(c.Credential)
+	if err != nil {
+		return fmt.Errorf("credential source %q: %w", c.CredentialSource, err)
+	}
+	w := printers.GetNewTabWriter(streams.Out)
+	defer w.Flush()
+	fmt.Fprintf(w, "Source:\t%s\n", c.CredentialSource)
+	if len(c.RoleArn) != 0 {
+		fmt.Fprintf(w, "Role:\t%s\n", c.RoleArn)
+	}
+	fmt.Fprintf(w, "AccessKeyId:\t%s\n", accessKeyId)
+	fmt.Fprintf(w, "Region:\t%s\n", c.Region)
+	fmt.Fprintf(w, "Context:\t%s\n", c.CurrentContext)
+	fmt.Fprintf(w, "Server:\t%s\n", c.ClusterServer)
+	return nil
+}
@@ -0,0 +1,95 @@
+package cp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// maxMismatchesShown bounds the files named by a failed verification
+const maxMismatchesShown = 5
+
+// checksums maps the tar names of the copied regular files to their hex SHA-256
+type checksums map[string]string
+
+// verify compares the checksums of the copied files with the ones computed in the instance, where path is the copied
+// file or directory. Files can't be verified without find and sha256sum, which is only warned about.
+func (o *CopyOptions) verify(spec fileSpec, path remotePath, sums checksums, progress *progress) error {
+	if len(sums) == 0 {
+		progress.done(0, false)
+		return nil
+	}
+	remote, err := o.remoteChecksums(spec, path)
+	if err != nil {
+		progress.done(len(sums), false)
+		fmt.Fprintf(o.ErrOut, "warning: skipping checksum verification: %v\n", err)
+		return nil
+	}
+	if err = compareChecksums(sums, remote); err != nil {
+		progress.done(len(sums), false)
+		return err
+	}
+	progress.done(len(sums), true)
+	return nil
+}
+
+// compareChecksums fails naming the copied files whose checksum in the instance differs.
+func compareChecksums(sums, remote checksums) error {
+	var mismatches []string
+	for name, sum := range sums {
+		if remote[name] != sum {
+			mismatches = append(mismatches, name)
+		}
+	}
+	if len(mismatches) == 0 {
+		return nil
+	}
+	n := len(mismatches)
+	sort.Strings(mismatches)
+	if n > maxMismatchesShown {
+		mismatches = append(mismatches[:maxMismatchesShown], "...")
+	}
+	return fmt.Errorf("checksums of %d of %d copied files differ, copy them again: %s", n, len(sums), strings.Join(mismatches, ", "))
+}
+
+// remoteChecksums lists the SHA-256 of the regular files below path in the instance, named like in the tar streams.
+func (o *CopyOptions) remoteChecksums(spec fileSpec, path remotePath) (checksums, error) {
+	var out, errOut bytes.Buffer
+	cmd := []string{"sh", "-c", `cd "$1" && find "$2" -type f -exec sha256sum {} +`, "sh", path.Dir().String(), path.Base().String()}
+	if err := o.execute(spec, cmd, genericclioptions.IOStreams{Out: &out, ErrOut: &errOut}); err != nil {
+		if msg := strings.TrimSpace(errOut.String()); len(msg) != 0 {
+			return nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, err
+	}
+	return parseChecksums(&out)
+}
+
+// parseChecksums reads the output of sha256sum.
+func parseChecksums(r io.Reader) (checksums, error) {
+	sums := checksums{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		// names with a backslash or newline are escaped, and the line starts with a backslash
+		escaped := strings.HasPrefix(line, `\`)
+		line = strings.TrimPrefix(line, `\`)
+		sum, name, ok := strings.Cut(line, " ")
+		// the name follows a space and the mode, ' ' for text or '*' for binary
+		if !ok || len(sum) != 2*sha256.Size || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+			continue
+		}
+		name = name[1:]
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n").Replace(name)
+		}
+		sums[name] = sum
+	}
+	return sums, scanner.Err()
+}
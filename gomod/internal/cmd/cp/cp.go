@@ -0,0 +1,484 @@
+/*
+Copyright 2016 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cp
+
+// the code copy and paste from https://github.com/kubernetes/kubectl/blob/master/pkg/cmd/cp/cp.go,
+// the tar streams go through the webshell exec of SAE
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/exec"
+	"saectl/internal/cmd/exec/stream"
+	"saectl/internal/cmd/util"
+)
+
+var (
+	cpLong = templates.LongDesc(i18n.T(`
+		Copy files and directories to and from SAE instances.
+
+		The files are streamed as tar through the webshell, so the 'tar' binary must be present
+		in the container image, next to sh, stty, mktemp, base64 and sed which exec without
+		TTY needs. After the transfer the SHA-256 checksums of the copied files are
+		compared on both sides, which needs 'find' and 'sha256sum' in the container.`))
+
+	cpExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Copy /tmp/foo local file to /tmp/bar in a remote instance in namespace <some-namespace>
+		%s cp /tmp/foo <some-namespace>/<some-pod>:/tmp/bar
+
+		# Copy /tmp/foo_dir local directory to /tmp/bar_dir in a remote instance in the default namespace
+		%s cp /tmp/foo_dir <some-pod>:/tmp/bar_dir
+
+		# Copy /tmp/foo local file to /tmp/bar in a remote instance in a specific container
+		%s cp /tmp/foo <some-pod>:/tmp/bar -c <specific-container>
+
+		# Copy the heap dump /home/admin/heap.hprof from a remote instance into the current directory
+		%s cp <some-namespace>/<some-pod>:/home/admin/heap.hprof .`, 4)))
+)
+
+// CopyOptions have the data required to perform the copy operation
+type CopyOptions struct {
+	Container  string
+	NoPreserve bool
+
+	factory util.AliCloudFactory
+	// instance runs the commands in the remote instance
+	instance *exec.Options
+
+	args []string
+
+	genericclioptions.IOStreams
+}
+
+// NewCopyOptions creates the options for copy
+func NewCopyOptions(ioStreams genericclioptions.IOStreams) *CopyOptions {
+	return &CopyOptions{
+		IOStreams: ioStreams,
+	}
+}
+
+// NewCmdCp creates a new Copy command.
+func NewCmdCp(f util.AliCloudFactory, ioStreams genericclioptions.IOStreams) *cobra.Command {
+	o := NewCopyOptions(ioStreams)
+
+	cmd := &cobra.Command{
+		Use:                   "cp <file-spec-src> <file-spec-dest>",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Copy files and directories to and from instances"),
+		Long:                  cpLong,
+		Example:               cpExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f, cmd, args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmdutil.AddContainerVarFlags(cmd, &o.Container, o.Container)
+	cmd.Flags().BoolVarP(&o.NoPreserve, "no-preserve", "", false, "The copied file/directory's ownership and permissions will not be preserved, neither in the container nor locally")
+
+	return cmd
+}
+
+var (
+	errFileSpecDoesntMatchFormat = errors.New("filespec must match the canonical format: [[namespace/]pod:]file/path")
+)
+
+func extractFileSpec(arg string) (fileSpec, error) {
+	i := strings.Index(arg, ":")
+
+	// filespec starting with a semicolon is invalid
+	if i == 0 {
+		return fileSpec{}, errFileSpecDoesntMatchFormat
+	}
+	if i == -1 {
+		return fileSpec{
+			File: newLocalPath(arg),
+		}, nil
+	}
+
+	pod, file := arg[:i], arg[i+1:]
+	pieces := strings.Split(pod, "/")
+	switch len(pieces) {
+	case 1:
+		return fileSpec{
+			PodName: pieces[0],
+			File:    newRemotePath(file),
+		}, nil
+	case 2:
+		return fileSpec{
+			PodNamespace: pieces[0],
+			PodName:      pieces[1],
+			File:         newRemotePath(file),
+		}, nil
+	default:
+		return fileSpec{}, errFileSpecDoesntMatchFormat
+	}
+}
+
+// Complete completes all the required options
+func (o *CopyOptions) Complete(f util.AliCloudFactory, cmd *cobra.Command, args []string) error {
+	o.factory = f
+	o.args = args
+	return nil
+}
+
+// Validate makes sure provided values for CopyOptions are valid
+func (o *CopyOptions) Validate() error {
+	if len(o.args) != 2 {
+		return fmt.Errorf("source and destination are required")
+	}
+	return nil
+}
+
+// Run performs the execution
+func (o *CopyOptions) Run() error {
+	srcSpec, err := extractFileSpec(o.args[0])
+	if err != nil {
+		return err
+	}
+	destSpec, err := extractFileSpec(o.args[1])
+	if err != nil {
+		return err
+	}
+
+	if len(srcSpec.PodName) != 0 && len(destSpec.PodName) != 0 {
+		return fmt.Errorf("one of src or dest must be a local file specification")
+	}
+	if len(srcSpec.File.String()) == 0 || len(destSpec.File.String()) == 0 {
+		return errors.New("filepath can not be empty")
+	}
+
+	if len(srcSpec.PodName) != 0 {
+		return o.copyFromPod(srcSpec, destSpec)
+	}
+	if len(destSpec.PodName) != 0 {
+		return o.copyToPod(srcSpec, destSpec)
+	}
+	return fmt.Errorf("one of src or dest must be a remote file specification")
+}
+
+// checkDestinationIsDir receives a destination fileSpec and
+// determines if the provided destination path exists on the
+// pod and is a directory. Only a non-zero exit code of test
+// means it is not, any other failure is returned.
+func (o *CopyOptions) checkDestinationIsDir(dest fileSpec) (bool, error) {
+	err := o.execute(dest, []string{"test", "-d", dest.File.String()}, genericclioptions.IOStreams{
+		Out:    io.Discard,
+		ErrOut: io.Discard,
+	})
+	var statusErr *stream.StatusError
+	if errors.As(err, &statusErr) && statusErr.ExitCode != 0 {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (o *CopyOptions) copyToPod(src, dest fileSpec) error {
+	if _, err := os.Stat(src.File.String()); err != nil {
+		return fmt.Errorf("%s doesn't exist in local filesystem", src.File)
+	}
+	reader, writer := io.Pipe()
+
+	srcFile := src.File.(localPath)
+	destFile := dest.File.(remotePath)
+
+	isDir, err := o.checkDestinationIsDir(dest)
+	if err != nil {
+		return err
+	}
+	if isDir {
+		// dest.File was found to be a directory.
+		// Copy specified src into it
+		destFile = destFile.Join(srcFile.Base())
+	}
+
+	progress := newProgress(o.ErrOut, "Copying")
+	sums := checksums{}
+	tarErr := make(chan error, 1)
+	go func(src localPath, dest remotePath, writer io.WriteCloser) {
+		defer writer.Close()
+		tarErr <- makeTar(src, dest, progress.writer(writer), sums)
+	}(srcFile, destFile, writer)
+	var cmdArr []string
+
+	if o.NoPreserve {
+		cmdArr = []string{"tar", "--no-same-permissions", "--no-same-owner", "-xmf", "-"}
+	} else {
+		cmdArr = []string{"tar", "-xmf", "-"}
+	}
+	destFileDir := destFile.Dir().String()
+	if len(destFileDir) > 0 {
+		cmdArr = append(cmdArr, "-C", destFileDir)
+	}
+
+	err = o.execute(dest, cmdArr, genericclioptions.IOStreams{
+		In:     reader,
+		Out:    o.Out,
+		ErrOut: o.ErrOut,
+	})
+	// unblock the tar writer if the session ended before reading all of it
+	if err != nil {
+		reader.CloseWithError(err)
+	} else {
+		reader.CloseWithError(errors.New("tar in the instance exited before reading the whole archive"))
+	}
+	if localErr := <-tarErr; localErr != nil {
+		// a truncated tar fails to extract, but the local failure tells why
+		if err == nil || !errors.Is(localErr, err) {
+			return localErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return o.verify(dest, destFile.Clean(), sums, progress)
+}
+
+func (o *CopyOptions) copyFromPod(src, dest fileSpec) error {
+	srcFile := src.File.(remotePath).Clean()
+	destFile := dest.File.(localPath)
+	if srcFile.String() == "/" {
+		return errors.New("the root directory of an instance can't be copied, copy its directories instead")
+	}
+
+	reader, writer := io.Pipe()
+	execErr := make(chan error, 1)
+	go func() {
+		// tar from the parent directory, so the names of the entries start with the base name of src
+		err := o.execute(src, []string{"tar", "cf", "-", "-C", srcFile.Dir().String(), srcFile.Base().String()}, genericclioptions.IOStreams{
+			Out:    writer,
+			ErrOut: o.ErrOut,
+		})
+		writer.CloseWithError(err)
+		execErr <- err
+	}()
+
+	progress := newProgress(o.ErrOut, "Copying")
+	sums := checksums{}
+	prefix := srcFile.Base().String()
+	if err := o.untarAll(src.PodNamespace, src.PodName, prefix, srcFile, destFile, progress.reader(reader), sums); err != nil {
+		reader.CloseWithError(err)
+		return err
+	}
+	// tar pads the archive after its end
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		return err
+	}
+	if err := <-execErr; err != nil {
+		return err
+	}
+	return o.verify(src, srcFile, sums, progress)
+}
+
+func makeTar(src localPath, dest remotePath, writer io.Writer, sums checksums) error {
+	tarWriter := tar.NewWriter(writer)
+	defer tarWriter.Close()
+
+	srcPath := src.Clean()
+	destPath := dest.Clean()
+	if err := recursiveTar(srcPath.Dir(), srcPath.Base(), destPath.Dir(), destPath.Base(), tarWriter, sums); err != nil {
+		return err
+	}
+	return tarWriter.Close()
+}
+
+func recursiveTar(srcDir, srcFile localPath, destDir, destFile remotePath, tw *tar.Writer, sums checksums) error {
+	matchedPaths, err := srcDir.Join(srcFile).Glob()
+	if err != nil {
+		return err
+	}
+	for _, fpath := range matchedPaths {
+		stat, err := os.Lstat(fpath)
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() {
+			files, err := os.ReadDir(fpath)
+			if err != nil {
+				return err
+			}
+			if len(files) == 0 {
+				//case empty directory
+				hdr, _ := tar.FileInfoHeader(stat, fpath)
+				hdr.Name = destFile.String()
+				if err := tw.WriteHeader(hdr); err != nil {
+					return err
+				}
+			}
+			for _, f := range files {
+				if err := recursiveTar(srcDir, srcFile.Join(newLocalPath(f.Name())),
+					destDir, destFile.Join(newRemotePath(f.Name())), tw, sums); err != nil {
+					return err
+				}
+			}
+			return nil
+		} else if stat.Mode()&os.ModeSymlink != 0 {
+			//case soft link
+			hdr, _ := tar.FileInfoHeader(stat, fpath)
+			target, err := os.Readlink(fpath)
+			if err != nil {
+				return err
+			}
+
+			hdr.Linkname = target
+			hdr.Name = destFile.String()
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+		} else {
+			//case regular file or other file type like pipe
+			hdr, err := tar.FileInfoHeader(stat, fpath)
+			if err != nil {
+				return err
+			}
+			hdr.Name = destFile.String()
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+
+			f, err := os.Open(fpath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			hash := sha256.New()
+			if _, err := io.Copy(io.MultiWriter(tw, hash), f); err != nil {
+				return err
+			}
+			if stat.Mode().IsRegular() {
+				sums[hdr.Name] = hex.EncodeToString(hash.Sum(nil))
+			}
+			return f.Close()
+		}
+	}
+	return nil
+}
+
+func (o *CopyOptions) untarAll(ns, pod string, prefix string, src remotePath, dest localPath, reader io.Reader, sums checksums) error {
+	symlinkWarningPrinted := false
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			if err != io.EOF {
+				return err
+			}
+			break
+		}
+
+		// All the files will start with the prefix, which is the directory where
+		// they were located on the pod, we need to strip down that prefix, but
+		// if the prefix is missing it means the tar was tempered with.
+		// For the case where prefix is empty we need to ensure that the path
+		// is not absolute, which also indicates the tar file was tempered with.
+		if !strings.HasPrefix(header.Name, prefix) {
+			return fmt.Errorf("tar contents corrupted")
+		}
+
+		// basic file information
+		mode := header.FileInfo().Mode()
+		// header.Name is a name of the REMOTE file, so we need to create
+		// a remotePath so that it goes through appropriate processing related
+		// with cleaning remote paths
+		destFileName := dest.Join(newRemotePath(header.Name[len(prefix):]))
+		// a single file is copied into an existing directory, like the heap dump into "."
+		if header.Name == prefix && !header.FileInfo().IsDir() {
+			if info, err := os.Stat(dest.String()); err == nil && info.IsDir() {
+				destFileName = dest.Join(src.Base())
+			}
+		}
+
+		if !isRelative(dest, destFileName) {
+			fmt.Fprintf(o.IOStreams.ErrOut, "warning: file %q is outside target destination, skipping\n", destFileName)
+			continue
+		}
+
+		if err := os.MkdirAll(destFileName.Dir().String(), 0755); err != nil {
+			return err
+		}
+		if header.FileInfo().IsDir() {
+			if err := os.MkdirAll(destFileName.String(), 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if mode&os.ModeSymlink != 0 {
+			if !symlinkWarningPrinted {
+				fmt.Fprintf(o.IOStreams.ErrOut,
+					"warning: skipping symlink: %q -> %q (consider using \"%s exec -n %q %q -- tar cf - %q | tar xf -\")\n",
+					destFileName, header.Linkname, help.CommandName, ns, pod, src)
+				symlinkWarningPrinted = true
+				continue
+			}
+			fmt.Fprintf(o.IOStreams.ErrOut, "warning: skipping symlink: %q -> %q\n", destFileName, header.Linkname)
+			continue
+		}
+		outFile, err := os.Create(destFileName.String())
+		if err != nil {
+			return err
+		}
+		defer outFile.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(outFile, hash), tarReader); err != nil {
+			return err
+		}
+		if err := outFile.Close(); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			sums[header.Name] = hex.EncodeToString(hash.Sum(nil))
+		}
+		if !o.NoPreserve {
+			if err := os.Chmod(destFileName.String(), mode.Perm()); err != nil {
+				return err
+			}
+			if err := os.Chtimes(destFileName.String(), header.ModTime, header.ModTime); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// execute runs cmd in the instance of spec, the instance is resolved by the first command only.
+func (o *CopyOptions) execute(spec fileSpec, cmd []string, streams genericclioptions.IOStreams) error {
+	if o.instance == nil {
+		instance, err := exec.NewOptions(o.factory, spec.PodName, spec.PodNamespace, o.Container)
+		if err != nil {
+			return err
+		}
+		o.instance = instance
+	}
+	return o.instance.Command(cmd, streams)
+}
@@ -0,0 +1,196 @@
+package cp
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestExtractFileSpec(t *testing.T) {
+	tests := []struct {
+		spec              string
+		expectedPod       string
+		expectedNamespace string
+		expectedFile      string
+		expectErr         bool
+	}{
+		{spec: "namespace/pod:/some/file", expectedPod: "pod", expectedNamespace: "namespace", expectedFile: "/some/file"},
+		{spec: "pod:/some/file", expectedPod: "pod", expectedFile: "/some/file"},
+		{spec: "/some/file", expectedFile: "/some/file"},
+		{spec: "some/file", expectedFile: "some/file"},
+		{spec: ":file:not:exist:in:local:filesystem", expectErr: true},
+		{spec: "namespace/pod/invalid:/some/file", expectErr: true},
+		{spec: "pod:", expectedPod: "pod"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			spec, err := extractFileSpec(test.spec)
+			if test.expectErr {
+				if err != errFileSpecDoesntMatchFormat {
+					t.Errorf("expected %v, got %v", errFileSpecDoesntMatchFormat, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if spec.PodName != test.expectedPod {
+				t.Errorf("expected pod %q, got %q", test.expectedPod, spec.PodName)
+			}
+			if spec.PodNamespace != test.expectedNamespace {
+				t.Errorf("expected namespace %q, got %q", test.expectedNamespace, spec.PodNamespace)
+			}
+			if spec.File.String() != test.expectedFile {
+				t.Errorf("expected file %q, got %q", test.expectedFile, spec.File)
+			}
+		})
+	}
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTarUntarRoundTrip(t *testing.T) {
+	files := map[string]string{
+		"a.txt":             "a",
+		"sub/b.txt":         "b",
+		"sub/deeper/c.conf": strings.Repeat("c", 64*1024),
+	}
+	tests := []struct {
+		name string
+		// src is copied from the source directory, dest is the local destination of the copy back
+		src, dest string
+		want      map[string]string
+		wantSums  []string
+	}{
+		{
+			name:     "directory",
+			src:      "data",
+			dest:     "restored",
+			want:     map[string]string{"restored/a.txt": "a", "restored/sub/b.txt": "b", "restored/sub/deeper/c.conf": files["sub/deeper/c.conf"]},
+			wantSums: []string{"data/a.txt", "data/sub/b.txt", "data/sub/deeper/c.conf"},
+		},
+		{
+			name:     "file into an existing directory",
+			src:      "data/sub/b.txt",
+			dest:     ".",
+			want:     map[string]string{"b.txt": "b"},
+			wantSums: []string{"b.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srcDir, destDir := t.TempDir(), t.TempDir()
+			writeFiles(t, filepath.Join(srcDir, "data"), files)
+
+			// the tar sent to the instance is the tar received from it
+			remote := newRemotePath("/remote/" + filepath.Base(tt.src))
+			buf := &bytes.Buffer{}
+			tarSums := checksums{}
+			if err := makeTar(newLocalPath(filepath.Join(srcDir, tt.src)), remote, buf, tarSums); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			o := &CopyOptions{IOStreams: genericclioptions.NewTestIOStreamsDiscard()}
+			dest := newLocalPath(filepath.Join(destDir, tt.dest))
+			untarSums := checksums{}
+			if err := o.untarAll("default", "pod", remote.Base().String(), remote, dest, buf, untarSums); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for name, content := range tt.want {
+				data, err := os.ReadFile(filepath.Join(destDir, name))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if string(data) != content {
+					t.Errorf("expected %s to hold %q, got %q", name, content, string(data))
+				}
+			}
+			if !reflect.DeepEqual(tarSums, untarSums) {
+				t.Errorf("expected the checksums of both sides to equal, got %v and %v", tarSums, untarSums)
+			}
+			for _, name := range tt.wantSums {
+				if len(untarSums[name]) != 64 {
+					t.Errorf("expected a checksum of %s, got %v", name, untarSums)
+				}
+			}
+		})
+	}
+}
+
+func TestParseChecksums(t *testing.T) {
+	output := strings.Join([]string{
+		"ca978112ca1bbdcafac231b39a23dc4da786eff8af9affd8da0c8e6e4c7d1a26  data/a.txt",
+		"3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d *data/b c.bin",
+		`\2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6  data/back\\slash\nnewline`,
+		"not a checksum line",
+		"",
+	}, "\n")
+	got, err := parseChecksums(strings.NewReader(output))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := checksums{
+		"data/a.txt":                "ca978112ca1bbdcafac231b39a23dc4da786eff8af9affd8da0c8e6e4c7d1a26",
+		"data/b c.bin":              "3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+		"data/back\\slash\nnewline": "2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestCompareChecksums(t *testing.T) {
+	sums := checksums{}
+	for i := 0; i < 8; i++ {
+		sums[fmt.Sprintf("data/%d.txt", i)] = fmt.Sprintf("%064d", i)
+	}
+	tests := []struct {
+		name    string
+		remote  checksums
+		wantErr string
+	}{
+		{name: "equal", remote: sums},
+		{
+			name:    "seven differ",
+			remote:  checksums{"data/0.txt": sums["data/0.txt"]},
+			wantErr: "checksums of 7 of 8 copied files differ, copy them again: data/1.txt, data/2.txt, data/3.txt, data/4.txt, data/5.txt, ...",
+		},
+		{
+			name:    "all missing",
+			remote:  checksums{},
+			wantErr: "checksums of 8 of 8 copied files differ, copy them again: data/0.txt, data/1.txt, data/2.txt, data/3.txt, data/4.txt, ...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := compareChecksums(sums, tt.remote)
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
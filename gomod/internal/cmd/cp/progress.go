@@ -0,0 +1,101 @@
+package cp
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	dockerterm "github.com/moby/term"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// progressInterval is how often the progress line is redrawn
+const progressInterval = 200 * time.Millisecond
+
+// progress redraws a line with the bytes transferred, when out is a terminal.
+type progress struct {
+	out   io.Writer
+	verb  string
+	start time.Time
+
+	lock    sync.Mutex
+	bytes   int64
+	printed time.Time
+}
+
+func newProgress(out io.Writer, verb string) *progress {
+	p := &progress{verb: verb, start: time.Now()}
+	if _, isTerminal := dockerterm.GetFdInfo(out); isTerminal {
+		p.out = out
+	}
+	return p
+}
+
+func (p *progress) add(n int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.bytes += int64(n)
+	if p.out == nil || time.Since(p.printed) < progressInterval {
+		return
+	}
+	p.printed = time.Now()
+	elapsed := time.Since(p.start).Seconds()
+	fmt.Fprintf(p.out, "\r\033[K%s %s (%s/s)", p.verb, formatBytes(p.bytes), formatBytes(int64(float64(p.bytes)/elapsed)))
+}
+
+// done replaces the progress line with a summary.
+func (p *progress) done(files int, verified bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.out == nil {
+		return
+	}
+	summary := fmt.Sprintf("Copied %s in %s, %d files", formatBytes(p.bytes), duration.HumanDuration(time.Since(p.start)), files)
+	if verified {
+		summary += ", checksums verified"
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s\n", summary)
+}
+
+func (p *progress) reader(r io.Reader) io.Reader {
+	return &progressReader{Reader: r, progress: p}
+}
+
+func (p *progress) writer(w io.Writer) io.Writer {
+	return &progressWriter{Writer: w, progress: p}
+}
+
+type progressReader struct {
+	io.Reader
+	progress *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.progress.add(n)
+	return n, err
+}
+
+type progressWriter struct {
+	io.Writer
+	progress *progress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.progress.add(n)
+	return n, err
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%dB", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	}
+	return fmt.Sprintf("%.1fGiB", float64(n)/(1<<30))
+}
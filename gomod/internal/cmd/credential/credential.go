@@ -0,0 +1,50 @@
+package credential
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	clientauthv1 "k8s.io/client-go/pkg/apis/clientauthentication/v1"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+
+	"saectl/internal/cmd/util"
+	"saectl/pkg/config"
+)
+
+// NewCmdCredentialProcess is the exec credential plugin referenced by kubeconfigs from "config export-kubeconfig".
+func NewCmdCredentialProcess(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "credential-process",
+		Short:  i18n.T("Print an ExecCredential for Kubernetes clients"),
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(run(f, streams))
+		},
+	}
+	return cmd
+}
+
+func run(f util.AliCloudFactory, streams genericclioptions.IOStreams) error {
+	// resolve the credentials up front so that a broken setup is reported by the Kubernetes client
+	c, err := f.ToClientConfig()
+	if err != nil {
+		return err
+	}
+	if _, err = config.CredentialAccessKeyId(c.Credential); err != nil {
+		return fmt.Errorf("credential source %q: %w", c.CredentialSource, err)
+	}
+	token, err := f.ToLocalToken()
+	if err != nil {
+		return err
+	}
+	cred := &clientauthv1.ExecCredential{
+		Status: &clientauthv1.ExecCredentialStatus{Token: token},
+	}
+	cred.SetGroupVersionKind(schema.GroupVersionKind{Group: clientauthv1.SchemeGroupVersion.Group, Version: clientauthv1.SchemeGroupVersion.Version, Kind: "ExecCredential"})
+	return json.NewEncoder(streams.Out).Encode(cred)
+}
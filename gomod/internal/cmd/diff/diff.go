@@ -608,12 +608,10 @@ func (o *DiffOptions) Complete(f cmdutil.Factory, cmd *cobra.Command, args []str
 		return err
 	}
 
-	o.ServerSideApply = cmdutil.GetServerSideApplyFlag(cmd)
-	o.FieldManager = apply.GetApplyFieldManagerFlag(cmd, o.ServerSideApply)
-	o.ForceConflicts = cmdutil.GetForceConflictsFlag(cmd)
-	if o.ForceConflicts && !o.ServerSideApply {
-		return fmt.Errorf("--force-conflicts only works with --server-side")
-	}
+	// the server-side apply flags are not registered, SAE is diffed with client-side apply
+	o.ServerSideApply = false
+	o.FieldManager = apply.FieldManagerClientSideApply
+	o.ForceConflicts = false
 
 	if !o.ServerSideApply {
 		o.OpenAPISchema, err = f.OpenAPISchema()
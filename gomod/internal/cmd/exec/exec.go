@@ -8,15 +8,16 @@ import (
 	"io"
 	"net/url"
 
-	"github.com/aliyun/alibaba-cloud-sdk-go/sdk"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	dockerterm "github.com/moby/term"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/websocket"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	appsclient "k8s.io/client-go/kubernetes/typed/apps/v1"
 	coreclient "k8s.io/client-go/kubernetes/typed/core/v1"
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/cmd/util/podcmd"
 	"k8s.io/kubectl/pkg/util/i18n"
 	"k8s.io/kubectl/pkg/util/interrupt"
 	"k8s.io/kubectl/pkg/util/templates"
@@ -25,63 +26,128 @@ import (
 	"saectl/cmd/help"
 	"saectl/internal/cmd/exec/stream"
 	"saectl/internal/cmd/util"
-	"saectl/pkg/options"
 	"saectl/pkg/proxy"
 )
 
 var (
+	execLong = templates.LongDesc(i18n.T(`
+		Execute a command in a container.
+
+		With -it a terminal session is started. Without it the command is typed into the shell
+		of the instance and runs to completion: stdout is streamed, stderr follows once the
+		command exited, piped stdin is passed on with -i and saectl exits with the exit code
+		of the command. This needs sh, stty, mktemp, base64 and sed in the container.`))
+
 	execExample = templates.Examples(i18n.T(help.Wrapper(`
 		# Switch to raw terminal mode; sends stdin to 'bash' in pod1 and sends stdout from 'bash' back to the client
 		%s exec -it mypod -n myns -- /bin/bash
-`, 1)))
+
+		# Print a file of mypod, the exit code of cat becomes the exit code of %s
+		%s exec mypod -n myns -- cat /app/config.yaml
+
+		# Pass a local file to a command in mypod
+		%s exec -i mypod -n myns -- sh -c 'cat > /tmp/config.yaml' < config.yaml
+
+		# Open a shell in the second ready instance of application myapp, in its sidecar container
+		%s exec -it deployment/myapp -n myns --instance-index 1 -c sidecar -- /bin/sh
+`, 5)))
 )
 
 func NewCmdExec(f util.AliCloudFactory, ioStreams genericclioptions.IOStreams) *cobra.Command {
 	execOption := new(Options)
 	cmd := &cobra.Command{
-		Use:     "exec -it POD -n NAMESPACE -- CMD",
+		Use:     "exec [-it] (POD | deployment/NAME | app/NAME) [-c CONTAINER] -n NAMESPACE -- CMD",
 		Example: execExample,
 		Short:   i18n.T("Execute a command in a container"),
-		Long:    i18n.T("Execute a command in a container."),
+		Long:    execLong,
 		Run: func(cmd *cobra.Command, args []string) {
-			cmdutil.CheckErr(execOption.Complete(f, args, ioStreams))
+			cmdutil.CheckErr(execOption.Complete(f, args, cmd.ArgsLenAtDash(), ioStreams))
 			cmdutil.CheckErr(execOption.Validate())
 			cmdutil.CheckErr(execOption.Run())
 		},
 	}
 	cmd.Flags().BoolVarP(&execOption.Stdin, "stdin", "i", execOption.Stdin, "Pass stdin to the container")
 	cmd.Flags().BoolVarP(&execOption.TTY, "tty", "t", execOption.TTY, "Stdin is a TTY")
+	cmd.Flags().StringVarP(&execOption.Container, "container", "c", execOption.Container, "Container name. If omitted, use the kubectl.kubernetes.io/default-container annotation for selecting the container to be attached or the first container in the pod will be chosen")
+	cmd.Flags().IntVar(&execOption.InstanceIndex, "instance-index", -1, "Index of the ready instance of deployment/NAME to exec into, ordered by name. If omitted, the only instance is used or one is chosen at the terminal")
 	return cmd
 }
 
 type Options struct {
 	tty term.TTY
 
-	options.AccountKey
 	StreamOptions
 
-	sdkClient *sdk.Client
+	Region string
+
+	Container     string
+	InstanceIndex int
+
+	sdkClient proxy.Processor
 	executor  *stream.Executor
 
-	podName   string
-	namespace string
-	podClient coreclient.PodsGetter
+	target           string
+	namespace        string
+	podClient        coreclient.PodsGetter
+	deploymentClient appsclient.DeploymentsGetter
+	// promptIn is stdin even without -i, to choose an instance
+	promptIn io.Reader
+	// session is resolved by the first run, later commands of the same Options reuse it
+	session *session
 
 	cmd []string
 }
 
-func (o *Options) Complete(f util.AliCloudFactory, argsIn []string, ioStreams genericclioptions.IOStreams) error {
-	if len(argsIn) == 0 {
-		return errors.New("podName shouldn't be empty")
+// session is where a command runs, each run still mints its own webshell token.
+type session struct {
+	appId     string
+	pod       string
+	container string
+}
+
+func (o *Options) Complete(f util.AliCloudFactory, argsIn []string, argsLenAtDash int, ioStreams genericclioptions.IOStreams) error {
+	if len(argsIn) == 0 || argsLenAtDash == 0 {
+		return errors.New("POD or deployment/NAME shouldn't be empty")
+	}
+	o.target = argsIn[0]
+	if argsLenAtDash > -1 {
+		o.cmd = argsIn[argsLenAtDash:]
+	} else if len(argsIn) > 1 {
+		o.cmd = argsIn[1:]
 	}
-	o.podName = argsIn[0]
-	o.AccountKey = f.GetAccountKey()
-	var err error
-	if len(o.StsToken) != 0 {
-		o.sdkClient, err = sdk.NewClientWithStsToken(o.Region, o.AccessKey, o.AccessSecret, o.StsToken)
-	} else {
-		o.sdkClient, err = sdk.NewClientWithAccessKey(o.Region, o.AccessKey, o.AccessSecret)
+	if err := o.completeClients(f); err != nil {
+		return err
 	}
+	o.promptIn = ioStreams.In
+	o.StreamOptions = StreamOptions{
+		IOStreams: ioStreams,
+		Stdin:     o.Stdin,
+		TTY:       o.TTY,
+	}
+	o.tty = o.StreamOptions.SetupTTY()
+	return nil
+}
+
+// NewOptions returns Options for the instance named by target, for commands built on exec like cp.
+// An empty namespace is the one of the flags.
+func NewOptions(f util.AliCloudFactory, target, namespace, container string) (*Options, error) {
+	o := &Options{target: target, Container: container, InstanceIndex: -1}
+	if err := o.completeClients(f); err != nil {
+		return nil, err
+	}
+	if len(namespace) != 0 {
+		o.namespace = namespace
+	}
+	return o, nil
+}
+
+func (o *Options) completeClients(f util.AliCloudFactory) error {
+	clientConfig, err := f.ToClientConfig()
+	if err != nil {
+		return err
+	}
+	o.Region = clientConfig.Region
+	o.sdkClient, err = clientConfig.SDKClient()
 	if err != nil {
 		return err
 	}
@@ -91,39 +157,68 @@ func (o *Options) Complete(f util.AliCloudFactory, argsIn []string, ioStreams ge
 		return err
 	}
 	o.podClient = clientSet.CoreV1()
+	o.deploymentClient = clientSet.AppsV1()
 	o.namespace, _, _ = cmdFactory.ToRawKubeConfigLoader().Namespace()
-	o.StreamOptions = StreamOptions{
-		IOStreams: ioStreams,
-		Stdin:     o.Stdin,
-		TTY:       o.TTY,
-	}
-	o.tty = o.StreamOptions.SetupTTY()
 	return nil
 }
 
+// Command runs cmd without TTY and quietly, stdin is passed if streams has one.
+// The instance is resolved by the first command and reused by the following ones.
+// A failed command returns a *stream.StatusError.
+func (o *Options) Command(cmd []string, streams genericclioptions.IOStreams) error {
+	c := *o
+	c.cmd = cmd
+	c.StreamOptions = StreamOptions{
+		IOStreams: streams,
+		Stdin:     streams.In != nil,
+		Quiet:     true,
+	}
+	c.tty = c.StreamOptions.SetupTTY()
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	err := c.Run()
+	o.session = c.session
+	return err
+}
+
 func (o *Options) Validate() error {
-	if len(o.podName) == 0 && len(o.namespace) == 0 {
+	if len(o.target) == 0 && len(o.namespace) == 0 {
 		return fmt.Errorf("pod, namespace must be specified")
 	}
-	if !o.TTY || !o.Stdin {
-		return fmt.Errorf("sorry, currently the exec command only supports start a new tty, please add \"-it\" for your command")
+	// without TTY there is no shell to type into
+	if !o.TTY && len(o.cmd) == 0 {
+		return fmt.Errorf("you must specify at least one command for the container, or add \"-it\" to start a shell")
 	}
 	return nil
 }
 
 func (o *Options) Run() error {
-	pod, err := o.podClient.Pods(o.namespace).Get(context.TODO(), o.podName, metav1.GetOptions{})
-	if err != nil {
-		return err
-	}
-	if len(pod.OwnerReferences) == 0 {
-		return fmt.Errorf("pod's owner shouldn't be empty")
+	if o.session == nil {
+		pod, appId, err := o.resolveInstance(context.TODO())
+		if err != nil {
+			return err
+		}
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			return fmt.Errorf("cannot exec into a container in a completed pod; current phase is %s", pod.Status.Phase)
+		}
+		container, err := podcmd.FindOrDefaultContainerByName(pod, o.Container, o.Quiet, o.ErrOut)
+		if err != nil {
+			return err
+		}
+		o.session = &session{appId: appId, pod: pod.Name, container: container.Name}
 	}
-	appId := string(pod.OwnerReferences[0].UID)
-	tokenId, err := o.GetWebShellToken(appId, o.podName)
+	tokenId, err := o.GetWebShellToken(o.session.appId, o.session.pod, o.session.container)
 	if err != nil {
 		return err
 	}
+	if !o.TTY {
+		e, err := o.NewExecutor(tokenId)
+		if err != nil {
+			return err
+		}
+		return e.Run()
+	}
 	fn := func() error {
 		e, err := o.NewExecutor(tokenId)
 		if err != nil {
@@ -148,15 +243,17 @@ func (o *Options) NewExecutor(tokenId string) (*stream.Executor, error) {
 	if err != nil {
 		return nil, err
 	}
+	// the session keeps the size the token was minted with, the console documents no message to resize it
 	return stream.NewExecutor(c, stream.Option{
-		Stdin:  o.In,
-		Stdout: o.Out,
-		StdErr: nil,
-		TTY:    o.tty.Raw,
+		Stdin:   o.In,
+		Stdout:  o.Out,
+		StdErr:  o.ErrOut,
+		TTY:     o.tty.Raw,
+		Command: o.cmd,
 	}), nil
 }
 
-func (o *Options) GetWebShellToken(appId string, podName string) (string, error) {
+func (o *Options) GetWebShellToken(appId string, podName string, containerName string) (string, error) {
 	popReq := requests.NewCommonRequest()
 	popReq.Scheme = proxy.OpenAPIScheme
 	popReq.Version = proxy.SAEYamlPopAPIVersion
@@ -164,13 +261,21 @@ func (o *Options) GetWebShellToken(appId string, podName string) (string, error)
 	popReq.ServiceCode = proxy.SAEPopServiceCode
 	popReq.EndpointType = "openAPI"
 	popReq.PathPattern = "/pop/v1/sam/instance/webshellToken"
-	termSize := o.tty.GetSize()
+	// RegionId, AppId, PodName, Lines and Columns are the parameters the SAE console sends for its webshell,
+	// ContainerName is only sent when needed. A session without TTY gets the same shell, see stream.Executor.Run.
 	popReq.QueryParams = map[string]string{
 		"RegionId": o.Region,
 		"AppId":    appId,
 		"PodName":  podName,
-		"Lines":    fmt.Sprintf("%d", termSize.Height),
-		"Columns":  fmt.Sprintf("%d", termSize.Width),
+		"Lines":    "24",
+		"Columns":  "80",
+	}
+	if len(containerName) != 0 {
+		popReq.QueryParams["ContainerName"] = containerName
+	}
+	if termSize := o.tty.GetSize(); termSize != nil {
+		popReq.QueryParams["Lines"] = fmt.Sprintf("%d", termSize.Height)
+		popReq.QueryParams["Columns"] = fmt.Sprintf("%d", termSize.Width)
 	}
 	res, err := o.sdkClient.ProcessCommonRequest(popReq)
 	if err != nil {
@@ -0,0 +1,150 @@
+package exec
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dockerterm "github.com/moby/term"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/kubectl/pkg/util/podutils"
+
+	"saectl/cmd/help"
+)
+
+// resolveInstance returns the instance named by the target, POD, pod/NAME, deployment/NAME or app/NAME,
+// and the AppId of its application.
+func (o *Options) resolveInstance(ctx context.Context) (*corev1.Pod, string, error) {
+	kind, name, ok := strings.Cut(o.target, "/")
+	if !ok {
+		kind, name = "pod", o.target
+	}
+	switch strings.ToLower(kind) {
+	case "pod", "pods", "po":
+		if o.InstanceIndex >= 0 {
+			return nil, "", fmt.Errorf("--instance-index only applies to deployment/NAME or app/NAME")
+		}
+		return o.getInstance(ctx, name)
+	case "deployment", "deployments", "deploy", "app", "apps":
+		return o.chooseInstance(ctx, name)
+	}
+	return nil, "", fmt.Errorf("unsupported resource type %q, exec into POD, deployment/NAME or app/NAME", kind)
+}
+
+func (o *Options) getInstance(ctx context.Context, name string) (*corev1.Pod, string, error) {
+	pod, err := o.podClient.Pods(o.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		// the application is often named instead of one of its instances
+		if _, getErr := o.deploymentClient.Deployments(o.namespace).Get(ctx, name, metav1.GetOptions{}); getErr == nil {
+			return nil, "", fmt.Errorf("%q is an application, not an instance, use deployment/%s to exec into one of its instances", name, name)
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	appId, err := o.appIdOf(pod)
+	if err != nil {
+		return nil, "", err
+	}
+	return pod, appId, nil
+}
+
+// chooseInstance picks a ready instance of an application: the one of --instance-index, the only one,
+// one chosen at a terminal or else the first one.
+func (o *Options) chooseInstance(ctx context.Context, name string) (*corev1.Pod, string, error) {
+	deployment, err := o.deploymentClient.Deployments(o.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, "", fmt.Errorf("fail to parse selector of application %q: %v", name, err)
+	}
+	pods, err := o.podClient.Pods(o.namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, "", err
+	}
+	var ready []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp == nil && podutils.IsPodReady(&pod) {
+			ready = append(ready, pod)
+		}
+	}
+	if len(ready) == 0 {
+		return nil, "", fmt.Errorf("application %q has no ready instance, list its instances with `%s get pods -n %s -l %s`", name, help.CommandName, o.namespace, selector)
+	}
+	// the instance index is stable as long as the instances are
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Name < ready[j].Name })
+
+	index := o.InstanceIndex
+	switch {
+	case index >= len(ready):
+		return nil, "", fmt.Errorf("--instance-index %d is out of range, application %q has %d ready instances", index, name, len(ready))
+	case index >= 0:
+	case len(ready) == 1:
+		index = 0
+	case o.canPrompt():
+		if index, err = o.promptInstance(name, ready); err != nil {
+			return nil, "", err
+		}
+	default:
+		index = 0
+		if !o.Quiet {
+			fmt.Fprintf(o.ErrOut, "Defaulted instance %q out of %d ready instances of application %q, choose another with --instance-index\n", ready[0].Name, len(ready), name)
+		}
+	}
+	pod := &ready[index]
+	appId, err := o.appIdOf(pod)
+	if err != nil {
+		return nil, "", err
+	}
+	return pod, appId, nil
+}
+
+// canPrompt tells whether someone is at the terminal to choose an instance.
+func (o *Options) canPrompt() bool {
+	_, inTerminal := dockerterm.GetFdInfo(o.promptIn)
+	_, errTerminal := dockerterm.GetFdInfo(o.ErrOut)
+	return inTerminal && errTerminal
+}
+
+func (o *Options) promptInstance(name string, instances []corev1.Pod) (int, error) {
+	fmt.Fprintf(o.ErrOut, "Application %q has %d ready instances:\n", name, len(instances))
+	w := printers.GetNewTabWriter(o.ErrOut)
+	fmt.Fprintln(w, "INDEX\tNAME\tIP\tAGE")
+	for i, pod := range instances {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i, pod.Name, pod.Status.PodIP, duration.HumanDuration(time.Since(pod.CreationTimestamp.Time)))
+	}
+	w.Flush()
+	reader := bufio.NewReader(o.promptIn)
+	for {
+		fmt.Fprintf(o.ErrOut, "Choose an instance [0-%d]: ", len(instances)-1)
+		line, err := reader.ReadString('\n')
+		if index, parseErr := strconv.Atoi(strings.TrimSpace(line)); parseErr == nil && index >= 0 && index < len(instances) {
+			return index, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("no instance chosen, choose one with --instance-index")
+		}
+	}
+}
+
+// appIdOf returns the AppId of the application owning an instance.
+func (o *Options) appIdOf(pod *corev1.Pod) (string, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil && len(pod.OwnerReferences) != 0 {
+		owner = &pod.OwnerReferences[0]
+	}
+	if owner == nil {
+		return "", fmt.Errorf("pod %q has no owner, so it isn't an instance of an SAE application; list the instances with `%s get pods -n %s`, or exec into an application with deployment/NAME", pod.Name, help.CommandName, o.namespace)
+	}
+	return string(owner.UID), nil
+}
@@ -0,0 +1,252 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// The webshell only offers a TTY session running a shell, so Run types the command into it. The shell
+// brackets the output with markers, carries stdout and stderr as base64, which never holds a ':',
+// and reports the exit code in between:
+//
+//	:saectl:begin:NONCE
+//	<stdout as base64>
+//	:saectl:status:NONCE:CODE
+//	<stderr as base64>
+//	:saectl:end:NONCE
+//
+// The typed line splits each marker from its nonce, so its echo never matches.
+const (
+	beginMarker  = ":saectl:begin:"
+	statusMarker = ":saectl:status:"
+	endMarker    = ":saectl:end:"
+)
+
+const (
+	// maxScriptSize keeps the typed line below the 4095 bytes a terminal reads as one line
+	maxScriptSize = 4000
+	// stdinChunkSize bounds the stdin lines, a multiple of 3 so each one encodes without padding
+	stdinChunkSize = 24 * 1024
+)
+
+// RequirementsError is returned when the shell of the session never ran the command.
+var RequirementsError = errors.New("the command did not start in the webshell session, exec without TTY needs sh, stty, mktemp, base64 and sed in the container")
+
+// Run runs Command without TTY: stdin is passed until EOF, stdout is written as it arrives, stderr once
+// the command exited, and a failed command is returned as *StatusError.
+func (e *Executor) Run() error {
+	defer e.Conn.Close()
+	nonce := rand.String(16)
+	script, err := commandScript(e.Command, nonce, e.Stdin != nil)
+	if err != nil {
+		return err
+	}
+	if _, err = e.Conn.Write([]byte(script + "\r")); err != nil {
+		return err
+	}
+
+	r, err := e.awaitBegin(nonce)
+	if err != nil {
+		return err
+	}
+	if e.Stdin != nil {
+		go func() {
+			defer runtime.HandleCrash()
+			if err := e.copyStdinLines(e.Stdin); err != nil {
+				runtime.HandleError(err)
+			}
+		}()
+	}
+
+	if err = decodeOutput(r, e.Stdout); err != nil {
+		return err
+	}
+	if err = readMarker(r, statusMarker+nonce+":"); err != nil {
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("fail to read the exit code of the command: %v", err)
+	}
+	exitCode, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return fmt.Errorf("fail to read the exit code of the command: %q", line)
+	}
+	if err = decodeOutput(r, e.StdErr); err != nil {
+		return err
+	}
+	if err = readMarker(r, endMarker+nonce); err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return &StatusError{Reason: remotecommand.NonZeroExitCodeReason, ExitCode: exitCode}
+	}
+	return nil
+}
+
+// commandScript is the line typed into the shell to run command. The terminal is switched to raw mode
+// first, so stdin passes unaltered and is not echoed, it is sent as base64 lines ended by a ".".
+func commandScript(command []string, nonce string, stdin bool) (string, error) {
+	args := make([]string, 0, len(command))
+	for _, arg := range command {
+		quoted, err := shellQuote(arg)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, quoted)
+	}
+	run := fmt.Sprintf(`( %s ); echo $? >"$e.rc"`, strings.Join(args, " "))
+	if stdin {
+		run = fmt.Sprintf(`sed -n '/^\.$/q;p' | base64 -d | { %s; }`, run)
+	} else {
+		run = fmt.Sprintf(`{ %s; } </dev/null`, run)
+	}
+	script := strings.Join([]string{
+		`stty raw -echo`,
+		`e=$(mktemp) || exit 1`,
+		fmt.Sprintf(`printf '%%s%%s\n' '%s' %s`, beginMarker, nonce),
+		fmt.Sprintf(`{ %s; } 2>"$e" | base64`, run),
+		fmt.Sprintf(`printf '%%s%%s:%%s\n' '%s' %s "$(cat "$e.rc")"`, statusMarker, nonce),
+		`base64 <"$e"`,
+		fmt.Sprintf(`printf '%%s%%s\n' '%s' %s`, endMarker, nonce),
+		`rm -f "$e" "$e.rc"`,
+		`stty sane`,
+		`exit`,
+	}, "; ")
+	if len(script) > maxScriptSize {
+		return "", fmt.Errorf("the command is too long to be typed into the webshell, it takes %d bytes of at most %d", len(script), maxScriptSize)
+	}
+	return script, nil
+}
+
+// shellQuote quotes arg for sh. Control characters are refused, the terminal would interpret them.
+func shellQuote(arg string) (string, error) {
+	for _, r := range arg {
+		if unicode.IsControl(r) {
+			return "", fmt.Errorf("the argument %q holds a control character, which cannot be typed into the webshell", arg)
+		}
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'", nil
+}
+
+// awaitBegin discards the output of the session, e.g. the prompt and the echo of the typed line, until
+// the begin marker. It returns the output following the marker.
+func (e *Executor) awaitBegin(nonce string) (*bufio.Reader, error) {
+	marker := []byte(beginMarker + nonce)
+	var data []byte
+	buf := make([]byte, 4096)
+	for {
+		n, err := e.Conn.Read(buf)
+		data = append(data, buf[:n]...)
+		if i := bytes.Index(data, marker); i >= 0 {
+			if j := bytes.IndexByte(data[i:], '\n'); j >= 0 {
+				rest := data[i+j+1:]
+				return bufio.NewReader(io.MultiReader(bytes.NewReader(rest), e.Conn)), nil
+			}
+		} else if i := bytes.LastIndex(data, statusPrefix); i >= 0 && parseStatusState(data[i:]) == completeStatus {
+			// the shell exited before printing the marker
+			return nil, RequirementsError
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, RequirementsError
+			}
+			return nil, err
+		}
+		// the marker may straddle two reads, the rest is output to discard
+		if len(data) > maxStatusSize {
+			data = data[len(data)-maxStatusSize:]
+		}
+	}
+}
+
+// copyStdinLines sends r as base64 lines and ends them with a ".", so the command sees EOF.
+func (e *Executor) copyStdinLines(r io.Reader) error {
+	buf := make([]byte, stdinChunkSize)
+	pending := 0
+	for {
+		n, err := r.Read(buf[pending:])
+		pending += n
+		end := pending - pending%3
+		if errors.Is(err, io.EOF) {
+			end = pending
+		}
+		if end > 0 {
+			if _, sendErr := e.Conn.Write([]byte(base64.StdEncoding.EncodeToString(buf[:end]) + "\n")); sendErr != nil {
+				return sendErr
+			}
+			pending = copy(buf, buf[end:pending])
+		}
+		if errors.Is(err, io.EOF) {
+			_, err = e.Conn.Write([]byte(".\n"))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// decodeOutput writes the base64 output of the command up to the next marker to w.
+func decodeOutput(r *bufio.Reader, w io.Writer) error {
+	if w == nil {
+		w = io.Discard
+	}
+	if _, err := io.Copy(w, base64.NewDecoder(base64.StdEncoding, untilMarker{r})); err != nil {
+		return fmt.Errorf("fail to decode the output of the command: %v", err)
+	}
+	return nil
+}
+
+// untilMarker reads up to the ':' starting the next marker.
+type untilMarker struct {
+	r *bufio.Reader
+}
+
+func (u untilMarker) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	next, err := u.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	if next[0] == ':' {
+		return 0, io.EOF
+	}
+	buffered, _ := u.r.Peek(u.r.Buffered())
+	n := len(buffered)
+	if i := bytes.IndexByte(buffered, ':'); i >= 0 {
+		n = i
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	return u.r.Read(p[:n])
+}
+
+// readMarker reads marker, output not following the protocol fails instead of waiting for more.
+func readMarker(r *bufio.Reader, marker string) error {
+	buf := make([]byte, len(marker))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("the webshell session closed before the command finished")
+		}
+		return err
+	}
+	if string(buf) != marker {
+		return fmt.Errorf("unexpected output of the webshell session: %q", buf)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/creack/pty"
+	"golang.org/x/net/websocket"
+)
+
+// dialShell connects to a webshell running shell in a terminal, like the console does: the terminal output
+// is sent as text messages, the messages received are typed and a Status follows once the shell exited.
+func dialShell(t *testing.T, shell ...string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		cmd := exec.Command(shell[0], shell[1:]...)
+		cmd.Env = append(os.Environ(), "PS1=$ ", "HOME=/")
+		tty, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: 24, Cols: 80})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer tty.Close()
+		go io.Copy(tty, conn)
+		buf := make([]byte, 4096)
+		for {
+			n, err := tty.Read(buf)
+			if n > 0 {
+				if sendErr := websocket.Message.Send(conn, string(buf[:n])); sendErr != nil {
+					break
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+		status := `{"metadata":{},"status":"Success"}`
+		if err := cmd.Wait(); err != nil {
+			status = fmt.Sprintf(`{"metadata":{},"status":"Failure","reason":"NonZeroExitCode","details":{"causes":[{"reason":"ExitCode","message":"%d"}]}}`, cmd.ProcessState.ExitCode())
+		}
+		websocket.Message.Send(conn, status)
+	}))
+	t.Cleanup(server.Close)
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestRun(t *testing.T) {
+	binary := make([]byte, 200*1024)
+	for i := range binary {
+		binary[i] = byte(i * 7)
+	}
+	tests := []struct {
+		name     string
+		command  []string
+		stdin    []byte
+		wantOut  string
+		wantErr  string
+		exitCode int
+	}{
+		{
+			name:    "binary stdin and stdout",
+			command: []string{"cat"},
+			stdin:   binary,
+			wantOut: string(binary),
+		},
+		{
+			name:    "empty stdin",
+			command: []string{"sh", "-c", "cat; echo done"},
+			stdin:   []byte{},
+			wantOut: "done\n",
+		},
+		{
+			name:    "without stdin",
+			command: []string{"sh", "-c", "cat; echo done"},
+			wantOut: "done\n",
+		},
+		{
+			name:     "exit code and stderr",
+			command:  []string{"sh", "-c", "echo out; echo err >&2; exit 3"},
+			wantOut:  "out\n",
+			wantErr:  "err\n",
+			exitCode: 3,
+		},
+		{
+			name:    "quoting",
+			command: []string{"printf", "%s|", "it's", "$HOME", "a  b", "!x", "*", `"\`, "exit"},
+			wantOut: `it's|$HOME|a  b|!x|*|"\|exit|`,
+		},
+		{
+			name:     "not found",
+			command:  []string{"saectl-missing-command"},
+			exitCode: 127,
+		},
+	}
+	for _, shell := range [][]string{{"sh"}, {"bash", "--norc", "--noprofile"}} {
+		if _, err := exec.LookPath(shell[0]); err != nil {
+			continue
+		}
+		for _, tt := range tests {
+			t.Run(shell[0]+"/"+tt.name, func(t *testing.T) {
+				stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+				option := Option{Stdout: stdout, StdErr: stderr, Command: tt.command}
+				if tt.stdin != nil {
+					option.Stdin = bytes.NewReader(tt.stdin)
+				}
+				err := NewExecutor(dialShell(t, shell...), option).Run()
+				if stdout.String() != tt.wantOut {
+					t.Errorf("expected stdout %q, got %q", truncate(tt.wantOut), truncate(stdout.String()))
+				}
+				if len(tt.wantErr) != 0 && stderr.String() != tt.wantErr {
+					t.Errorf("expected stderr %q, got %q", tt.wantErr, stderr.String())
+				}
+				if tt.exitCode == 0 {
+					if err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+					return
+				}
+				var statusErr *StatusError
+				if !errors.As(err, &statusErr) || statusErr.ExitStatus() != tt.exitCode {
+					t.Errorf("expected exit code %d, got %v", tt.exitCode, err)
+				}
+				if stderr.Len() == 0 {
+					t.Errorf("expected stderr of the failed command")
+				}
+			})
+		}
+	}
+}
+
+func truncate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
+
+func TestRunRequirements(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+	}{
+		{
+			name:     "shell exits",
+			messages: []string{"$ ", "sh: 1: mktemp: not found\r\n", `{"metadata":{},"status":"Failure","reason":"NonZeroExitCode","details":{"causes":[{"reason":"ExitCode","message":"1"}]}}`},
+		},
+		{
+			name:     "session closes",
+			messages: []string{"$ "},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewExecutor(dialMessages(t, tt.messages...), Option{Command: []string{"true"}}).Run()
+			if !errors.Is(err, RequirementsError) {
+				t.Errorf("expected %v, got %v", RequirementsError, err)
+			}
+		})
+	}
+}
+
+func TestCommandScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		wantErr bool
+	}{
+		{name: "plain", command: []string{"ls", "-l"}},
+		{name: "control character", command: []string{"echo", "a\nb"}, wantErr: true},
+		{name: "too long", command: []string{"echo", strings.Repeat("a", maxScriptSize)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := commandScript(tt.command, "nonce", true)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if strings.Contains(script, beginMarker+"nonce") {
+				t.Errorf("expected the typed line to split the marker from its nonce, got %s", script)
+			}
+		})
+	}
+}
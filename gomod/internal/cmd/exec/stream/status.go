@@ -0,0 +1,84 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// NoStatusError is returned when a session ends before its Status tells how the shell exited.
+var NoStatusError = errors.New("the webshell session closed without a status")
+
+// StatusError is the Status a session failed with, the exit code is set if the command ran and failed.
+// It is an exec.ExitError, so saectl exits with the exit code of the command.
+type StatusError struct {
+	Reason   metav1.StatusReason
+	ExitCode int
+	Message  string
+}
+
+var _ exec.ExitError = &StatusError{}
+
+func (e *StatusError) Error() string {
+	if e.ExitCode != 0 {
+		return fmt.Sprintf("command terminated with exit code %d", e.ExitCode)
+	}
+	if len(e.Message) != 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("command failed: %s", e.Reason)
+}
+
+func (e *StatusError) String() string {
+	return e.Error()
+}
+
+func (e *StatusError) Exited() bool {
+	return e.ExitCode != 0
+}
+
+func (e *StatusError) ExitStatus() int {
+	if e.ExitCode != 0 {
+		return e.ExitCode
+	}
+	return 1
+}
+
+// decodeStatus interprets the Status ending a session like kubectl does.
+func decodeStatus(data []byte) error {
+	status := metav1.Status{}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("error stream protocol error: %v in %q", err, string(data))
+	}
+	if status.Status == metav1.StatusSuccess {
+		return nil
+	}
+	statusErr := &StatusError{Reason: status.Reason, Message: status.Message}
+	if status.Reason == remotecommand.NonZeroExitCodeReason && status.Details != nil {
+		for _, cause := range status.Details.Causes {
+			if cause.Type != remotecommand.ExitCodeCauseType {
+				continue
+			}
+			rc, err := strconv.ParseUint(cause.Message, 10, 8)
+			if err != nil {
+				return fmt.Errorf("error stream protocol error: invalid exit code value %q", cause.Message)
+			}
+			statusErr.ExitCode = int(rc)
+		}
+	}
+	return statusErr
+}
+
+// write discards data without writer, e.g. stderr of a caller only interested in stdout.
+func write(w io.Writer, data []byte) (int, error) {
+	if w == nil {
+		return len(data), nil
+	}
+	return w.Write(data)
+}
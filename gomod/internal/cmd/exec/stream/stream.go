@@ -1,21 +1,28 @@
 package stream
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"strings"
 	"sync"
+	"time"
 
 	"golang.org/x/net/websocket"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/remotecommand"
 )
 
 type Option struct {
-	Stdin             io.Reader
-	Stdout            io.Writer
-	StdErr            io.Writer
-	TTY               bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	StdErr io.Writer
+	TTY    bool
+	// Command is run by Run in the shell of the session
+	Command           []string
 	TerminalSizeQueue remotecommand.TerminalSizeQueue
 }
 
@@ -31,65 +38,151 @@ func NewExecutor(conn *websocket.Conn, op Option) *Executor {
 	}
 }
 
+// Stream runs an interactive session: the terminal's stdin is sent as it is typed and the output is
+// written as it arrives, neither is framed. The session ends with the Status the webshell sends once
+// the shell exited, a session closed without one fails with NoStatusError.
 func (e *Executor) Stream() error {
-	stop := make(chan struct{})
+	defer e.Conn.Close()
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	e.copyStdin(ctx, e.Stdin)
-	e.copyStdout(stop, e.Stdout)
+	return e.receiveRaw(ctx)
+}
 
-	select {
-	case <-stop:
-		cancel()
-		return nil
+// statusPrefix starts the v1 Status the webshell sends after the shell of a TTY session exited.
+var statusPrefix = []byte(`{"metadata":{},"status":"`)
+
+const (
+	// statusGrace is how long output that may be the Status is held back. A Status is the end of the
+	// session only if nothing follows it within statusGrace, a program printing one is followed by the prompt.
+	statusGrace = 200 * time.Millisecond
+	// maxStatusSize bounds the output held back as a possible Status
+	maxStatusSize = 64 * 1024
+)
+
+// statusState tells whether data, starting with statusPrefix, is a Status.
+type statusState int
+
+const (
+	notStatus statusState = iota
+	partialStatus
+	completeStatus
+)
+
+func parseStatusState(data []byte) statusState {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	status := metav1.Status{}
+	if err := decoder.Decode(&status); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) && len(data) <= maxStatusSize {
+			return partialStatus
+		}
+		return notStatus
 	}
+	if len(bytes.TrimSpace(data[decoder.InputOffset():])) != 0 {
+		return notStatus
+	}
+	return completeStatus
 }
 
-func (e *Executor) copyStdin(ctx context.Context, r io.Reader) {
-	var once sync.Once
-	go func() {
-		defer runtime.HandleCrash()
-		defer once.Do(func() { e.Conn.Close() })
-		if _, err := io.Copy(e.Conn, NewGuardStdIn(ctx, r)); err != nil {
-			runtime.HandleError(err)
+// partialPrefixLen is the length of the longest end of data which may continue as statusPrefix.
+func partialPrefixLen(data []byte) int {
+	for n := len(statusPrefix) - 1; n > 0; n-- {
+		if bytes.HasSuffix(data, statusPrefix[:n]) {
+			return n
 		}
-	}()
+	}
+	return 0
 }
 
-func (e *Executor) copyStdout(stop chan struct{}, w io.Writer) {
+// receiveRaw writes the output of a TTY session until its Status arrives. Output which is or may become
+// a Status, also when split over several messages, is held back until the session stays silent for
+// statusGrace or is closed. Then a complete Status ends the session, anything else is written.
+func (e *Executor) receiveRaw(ctx context.Context) error {
+	type result struct {
+		msg []byte
+		err error
+	}
+	results := make(chan result)
 	go func() {
 		defer runtime.HandleCrash()
-		defer io.Copy(io.Discard, e.Conn)
-		if _, err := io.Copy(w, NewGuardStdOut(e.Conn, stop)); err != nil {
-			runtime.HandleError(err)
+		for {
+			var msg []byte
+			err := websocket.Message.Receive(e.Conn, &msg)
+			select {
+			case results <- result{msg: msg, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
 		}
 	}()
-}
 
-type guardStdOut struct {
-	io.Reader
-	stop chan struct{}
-}
+	var held []byte
+	timer := time.NewTimer(statusGrace)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		var r result
+		select {
+		case r = <-results:
+		case <-timer.C:
+			if parseStatusState(held) == completeStatus {
+				return decodeStatus(held)
+			}
+			if _, err := write(e.Stdout, held); err != nil {
+				return err
+			}
+			held = nil
+			continue
+		}
+		if r.err != nil {
+			if len(held) != 0 && parseStatusState(held) == completeStatus {
+				return decodeStatus(held)
+			}
+			if _, err := write(e.Stdout, held); err != nil {
+				return err
+			}
+			if errors.Is(r.err, io.EOF) {
+				return NoStatusError
+			}
+			return r.err
+		}
 
-func NewGuardStdOut(r io.Reader, stop chan struct{}) io.Reader {
-	return &guardStdOut{
-		Reader: r,
-		stop:   stop,
+		data := append(held, r.msg...)
+		held = nil
+		if i := bytes.LastIndex(data, statusPrefix); i >= 0 && parseStatusState(data[i:]) != notStatus {
+			held = data[i:]
+		} else {
+			held = data[len(data)-partialPrefixLen(data):]
+		}
+		if _, err := write(e.Stdout, data[:len(data)-len(held)]); err != nil {
+			return err
+		}
+		held = append([]byte(nil), held...)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if len(held) != 0 {
+			timer.Reset(statusGrace)
+		}
 	}
 }
 
-func (g *guardStdOut) Read(p []byte) (n int, err error) {
-	n, err = g.Reader.Read(p)
-	if strings.Contains(string(p), "{\"metadata\":{},\"status\":\"Failure\"") ||
-		strings.Contains(string(p), "{\"metadata\":{},\"status\":\"Success\"") {
-		g.stop <- struct{}{}
-		return 0, io.EOF
-	}
-	if err != nil {
-		g.stop <- struct{}{}
-		return 0, io.EOF
-	}
-	return n, nil
+func (e *Executor) copyStdin(ctx context.Context, r io.Reader) {
+	var once sync.Once
+	go func() {
+		defer runtime.HandleCrash()
+		defer once.Do(func() { e.Conn.Close() })
+		if _, err := io.Copy(e.Conn, NewGuardStdIn(ctx, r)); err != nil {
+			runtime.HandleError(err)
+		}
+	}()
 }
 
 type guardStdIn struct {
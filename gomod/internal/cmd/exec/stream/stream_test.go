@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+const exitStatus = `{"metadata":{},"status":"Failure","message":"command terminated with non-zero exit code","reason":"NonZeroExitCode","details":{"causes":[{"reason":"ExitCode","message":"2"}]}}`
+
+// dialMessages connects to a webshell sending messages as text, like the console does for a TTY session.
+func dialMessages(t *testing.T, messages ...string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		for _, msg := range messages {
+			if err := websocket.Message.Send(conn, msg); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http"), "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		wantOut  string
+		exitCode int
+		wantErr  error
+	}{
+		{
+			name:     "status in its own message",
+			messages: []string{"$ exit 2\r\n", exitStatus},
+			wantOut:  "$ exit 2\r\n",
+			exitCode: 2,
+		},
+		{
+			name:     "status after output",
+			messages: []string{"$ exit 2\r\nlogout\r\n" + exitStatus},
+			wantOut:  "$ exit 2\r\nlogout\r\n",
+			exitCode: 2,
+		},
+		{
+			name:     "output resembling a status",
+			messages: []string{`$ echo '{"metadata":{},"status":"Failure"'` + "\r\n", `{"metadata":{},"status":"Success"}`},
+			wantOut:  `$ echo '{"metadata":{},"status":"Failure"'` + "\r\n",
+		},
+		{
+			name:     "status split over messages",
+			messages: []string{"logout\r\n" + exitStatus[:10], exitStatus[10:40], exitStatus[40:]},
+			wantOut:  "logout\r\n",
+			exitCode: 2,
+		},
+		{
+			name:     "output ending in a status followed by the prompt",
+			messages: []string{"$ cat status.json\r\n" + exitStatus, "\r\n$ ", "exit\r\n", `{"metadata":{},"status":"Success"}`},
+			wantOut:  "$ cat status.json\r\n" + exitStatus + "\r\n$ exit\r\n",
+		},
+		{
+			name:     "partial status prefix is output",
+			messages: []string{"$ printf '{'\r\n{", "$ ", "exit\r\n", `{"metadata":{},"status":"Success"}`},
+			wantOut:  "$ printf '{'\r\n{$ exit\r\n",
+		},
+		{
+			name:     "closed without status",
+			messages: []string{"bye\r\n"},
+			wantOut:  "bye\r\n",
+			wantErr:  NoStatusError,
+		},
+		{
+			name:     "closed within a status",
+			messages: []string{"bye\r\n" + exitStatus[:40]},
+			wantOut:  "bye\r\n" + exitStatus[:40],
+			wantErr:  NoStatusError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin, stdinWriter := io.Pipe()
+			defer stdinWriter.Close()
+			out := &bytes.Buffer{}
+			err := NewExecutor(dialMessages(t, tt.messages...), Option{Stdin: stdin, Stdout: out, TTY: true}).Stream()
+			if out.String() != tt.wantOut {
+				t.Errorf("expected output %q, got %q", tt.wantOut, out.String())
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if tt.exitCode == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.ExitStatus() != tt.exitCode {
+				t.Errorf("expected exit code %d, got %v", tt.exitCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package serve
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"k8s.io/kubectl/pkg/util/i18n"
+	"k8s.io/kubectl/pkg/util/templates"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/util"
+	"saectl/pkg/config"
+)
+
+// DefaultListen is the address served by default, exported kubeconfigs point to it.
+const DefaultListen = config.LocalGatewayAddress
+
+var (
+	serveLong = templates.LongDesc(i18n.T(help.Wrapper(`
+		Run a local gateway speaking the Kubernetes API.
+
+		Every request received is translated into an SAE OpenAPI call signed with the
+		credentials %s resolves, so Kubernetes tooling can manage SAE applications without
+		linking %s. Discovery and OpenAPI endpoints are forwarded as well.
+
+		Local clients can be required to present a bearer token, either given by --token or
+		the local token handed out by the kubeconfig from "%s config export-kubeconfig".`, 3)))
+
+	serveExample = templates.Examples(i18n.T(help.Wrapper(`
+		# Serve the current context on 127.0.0.1:8001
+		%s serve
+
+		# Serve the prod context, accepting only the kubeconfig exported for it
+		%s --context=prod serve --local-token
+		%s --context=prod config export-kubeconfig -o ~/.kube/sae --merge`, 3)))
+)
+
+type ServeOptions struct {
+	Listen     string
+	Token      string
+	LocalToken bool
+
+	target    *url.URL
+	transport http.RoundTripper
+	genericclioptions.IOStreams
+}
+
+func NewCmdServe(f util.AliCloudFactory, streams genericclioptions.IOStreams) *cobra.Command {
+	o := &ServeOptions{Listen: DefaultListen, IOStreams: streams}
+	cmd := &cobra.Command{
+		Use:                   "serve [--listen=ADDRESS] [--token=TOKEN | --local-token]",
+		DisableFlagsInUseLine: true,
+		Short:                 i18n.T("Run a local Kubernetes API gateway to SAE"),
+		Long:                  serveLong,
+		Example:               serveExample,
+		Args:                  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(f))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVar(&o.Listen, "listen", o.Listen, "The address to listen on")
+	cmd.Flags().StringVar(&o.Token, "token", o.Token, "Bearer token local clients must present")
+	cmd.Flags().BoolVar(&o.LocalToken, "local-token", o.LocalToken, "Require the local token used by exported kubeconfigs")
+	return cmd
+}
+
+func (o *ServeOptions) Complete(f util.AliCloudFactory) error {
+	restConfig, err := f.NewCmdFactory().ToRESTConfig()
+	if err != nil {
+		return err
+	}
+	if o.target, _, err = rest.DefaultServerURL(restConfig.Host, "", schema.GroupVersion{}, true); err != nil {
+		return err
+	}
+	if o.transport, err = rest.TransportFor(restConfig); err != nil {
+		return err
+	}
+	if o.LocalToken {
+		if len(o.Token) != 0 {
+			return fmt.Errorf("--token and --local-token are mutually exclusive")
+		}
+		if o.Token, err = f.ToLocalToken(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *ServeOptions) Validate() error {
+	host, _, err := net.SplitHostPort(o.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %v", o.Listen, err)
+	}
+	if len(o.Token) == 0 && !isLoopback(host) {
+		fmt.Fprintf(o.ErrOut, "warning: %s is reachable from other hosts and no token is required\n", o.Listen)
+	}
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (o *ServeOptions) Run() error {
+	l, err := net.Listen("tcp", o.Listen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "Starting to serve on %s\n", l.Addr().String())
+	server := &http.Server{
+		Handler:           &gateway{target: o.target, token: o.Token, transport: o.transport},
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return server.Serve(l)
+}
+
+// hopHeaders only concern the connection to the gateway and are not forwarded.
+var hopHeaders = []string{"Authorization", "Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// gateway forwards Kubernetes REST requests to SAE through the proxy transport.
+type gateway struct {
+	target    *url.URL
+	token     string
+	transport http.RoundTripper
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !g.authorized(req) {
+		writeStatus(w, http.StatusUnauthorized, metav1.StatusReasonUnauthorized, "Unauthorized")
+		return
+	}
+	out := req.Clone(req.Context())
+	out.RequestURI = ""
+	out.Host = ""
+	out.URL = &url.URL{Scheme: g.target.Scheme, Host: g.target.Host, Path: req.URL.Path, RawQuery: req.URL.RawQuery}
+	for _, h := range hopHeaders {
+		out.Header.Del(h)
+	}
+
+	resp, err := g.transport.RoundTrip(out)
+	if err != nil {
+		klog.V(2).Infof("%s %s failed: %v", req.Method, req.URL.RequestURI(), err)
+		writeStatus(w, http.StatusBadGateway, metav1.StatusReasonServiceUnavailable, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	klog.V(2).Infof("%s %s %d", req.Method, req.URL.RequestURI(), resp.StatusCode)
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	for _, h := range hopHeaders {
+		w.Header().Del(h)
+	}
+	w.Header().Del("Content-Length")
+	w.WriteHeader(resp.StatusCode)
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		klog.V(2).Infof("fail to write response of %s %s: %v", req.Method, req.URL.RequestURI(), err)
+	}
+}
+
+func (g *gateway) authorized(req *http.Request) bool {
+	if len(g.token) == 0 {
+		return true
+	}
+	const prefix = "Bearer "
+	auth := req.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, prefix)), []byte(g.token)) == 1
+}
+
+func writeStatus(w http.ResponseWriter, code int, reason metav1.StatusReason, message string) {
+	status := &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(status)
+}
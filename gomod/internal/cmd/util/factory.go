@@ -2,12 +2,17 @@ package util
 
 import (
 	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+	"saectl/pkg/config"
 	"saectl/pkg/options"
 )
 
 type AliCloudFactory interface {
 	NewCmdFactory() cmdutil.Factory
-	GetAccountKey() options.AccountKey
+	ToClientConfig() (*config.ClientConfig, error)
+	ToFileAccess() *config.FileAccess
+	ToSessionCache() *config.SessionCache
+	ToLocalToken() (string, error)
+	ToAuditLog() string
 }
 
 type Factory struct {
@@ -24,6 +29,22 @@ func (f *Factory) NewCmdFactory() cmdutil.Factory {
 	return cmdutil.NewFactory(f.config)
 }
 
-func (f *Factory) GetAccountKey() options.AccountKey {
-	return f.config.GetAccountKey()
+func (f *Factory) ToClientConfig() (*config.ClientConfig, error) {
+	return f.config.ToClientConfig()
+}
+
+func (f *Factory) ToFileAccess() *config.FileAccess {
+	return f.config.ToFileAccess()
+}
+
+func (f *Factory) ToSessionCache() *config.SessionCache {
+	return f.config.ToSessionCache()
+}
+
+func (f *Factory) ToLocalToken() (string, error) {
+	return f.config.ToLocalToken()
+}
+
+func (f *Factory) ToAuditLog() string {
+	return f.config.ToAuditLog()
 }
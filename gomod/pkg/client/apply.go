@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/kubectl/pkg/util"
+)
+
+const (
+	// DefaultFieldManager is the field manager of the changes made by the helpers
+	DefaultFieldManager = "saectl"
+	// DefaultPollInterval is the interval at which Wait checks its condition
+	DefaultPollInterval = 2 * time.Second
+)
+
+// Option modifies a call of Apply, Scale or Wait.
+type Option func(*callOptions)
+
+type callOptions struct {
+	namespace    string
+	dryRun       bool
+	fieldManager string
+	pollInterval time.Duration
+}
+
+// InNamespace overrides the namespace of the Client, and the namespace of the object passed to Apply.
+func InNamespace(namespace string) Option {
+	return func(o *callOptions) {
+		o.namespace = namespace
+	}
+}
+
+// DryRun validates a change on the server without persisting it.
+func DryRun() Option {
+	return func(o *callOptions) {
+		o.dryRun = true
+	}
+}
+
+func FieldManager(name string) Option {
+	return func(o *callOptions) {
+		o.fieldManager = name
+	}
+}
+
+func PollInterval(interval time.Duration) Option {
+	return func(o *callOptions) {
+		o.pollInterval = interval
+	}
+}
+
+func newCallOptions(opts []Option) *callOptions {
+	o := &callOptions{fieldManager: DefaultFieldManager, pollInterval: DefaultPollInterval}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *callOptions) dryRunValue() []string {
+	if o.dryRun {
+		return []string{metav1.DryRunAll}
+	}
+	return nil
+}
+
+// resource returns the client of a resource named like kubectl does, e.g. deploy, deployments or deployments.apps.
+func (c *Client) resource(resource, namespace string) (dynamic.ResourceInterface, *meta.RESTMapping, error) {
+	gvr, err := c.mapper.ResourceFor(schema.ParseGroupResource(resource).WithVersion(""))
+	if err != nil {
+		return nil, nil, err
+	}
+	gvk, err := c.mapper.KindFor(gvr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.resourceForKind(gvk, namespace)
+}
+
+func (c *Client) resourceForKind(gvk schema.GroupVersionKind, namespace string) (dynamic.ResourceInterface, *meta.RESTMapping, error) {
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return c.dynamic.Resource(mapping.Resource), mapping, nil
+	}
+	if len(namespace) == 0 {
+		namespace = c.namespace
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(namespace), mapping, nil
+}
+
+// Apply creates obj or patches it like `saectl apply` does, so both can manage the same objects.
+// obj is either a typed object of client-go or an *unstructured.Unstructured, the applied object is returned.
+func (c *Client) Apply(ctx context.Context, obj runtime.Object, opts ...Option) (*unstructured.Unstructured, error) {
+	o := newCallOptions(opts)
+	modified, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if len(o.namespace) != 0 {
+		modified.SetNamespace(o.namespace)
+	}
+	gvk := modified.GroupVersionKind()
+	client, mapping, err := c.resourceForKind(gvk, modified.GetNamespace())
+	if err != nil {
+		return nil, err
+	}
+	name := modified.GetName()
+	if len(name) == 0 {
+		return nil, fmt.Errorf("fail to apply %s: name is required", mapping.Resource.Resource)
+	}
+	modifiedJSON, err := util.GetModifiedConfiguration(modified, true, unstructured.UnstructuredJSONScheme)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied *unstructured.Unstructured
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := client.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			if err := util.CreateApplyAnnotation(modified, unstructured.UnstructuredJSONScheme); err != nil {
+				return err
+			}
+			applied, err = client.Create(ctx, modified, metav1.CreateOptions{DryRun: o.dryRunValue(), FieldManager: o.fieldManager})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		patchType, patch, err := threeWayPatch(gvk, current, modifiedJSON)
+		if err != nil {
+			return fmt.Errorf("fail to compute patch of %s %s: %w", mapping.Resource.Resource, name, err)
+		}
+		if string(patch) == "{}" {
+			applied = current
+			return nil
+		}
+		applied, err = client.Patch(ctx, name, patchType, patch, metav1.PatchOptions{DryRun: o.dryRunValue(), FieldManager: o.fieldManager})
+		return err
+	})
+	return applied, err
+}
+
+// Scale sets the replicas of a resource with a scale subresource, e.g. deployments.
+func (c *Client) Scale(ctx context.Context, resource, name string, replicas int32, opts ...Option) error {
+	o := newCallOptions(opts)
+	client, _, err := c.resource(resource, o.namespace)
+	if err != nil {
+		return err
+	}
+	patch := []byte(fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas))
+	_, err = client.Patch(ctx, name, types.MergePatchType, patch,
+		metav1.PatchOptions{DryRun: o.dryRunValue(), FieldManager: o.fieldManager}, "scale")
+	return err
+}
+
+// threeWayPatch returns a strategic merge patch for the types of client-go and a JSON merge patch for others,
+// the same choice kubectl makes.
+func threeWayPatch(gvk schema.GroupVersionKind, current *unstructured.Unstructured, modified []byte) (types.PatchType, []byte, error) {
+	original, err := util.GetOriginalConfiguration(current)
+	if err != nil {
+		return "", nil, err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return "", nil, err
+	}
+	versioned, err := scheme.Scheme.New(gvk)
+	if runtime.IsNotRegisteredError(err) {
+		patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, currentJSON)
+		return types.MergePatchType, patch, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+	if err != nil {
+		return "", nil, err
+	}
+	patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, currentJSON, lookupPatchMeta, true)
+	return types.StrategicMergePatchType, patch, err
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	// typed objects usually leave apiVersion and kind empty
+	if u.GroupVersionKind().Empty() {
+		gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return nil, fmt.Errorf("fail to determine the kind of %T: %w", obj, err)
+		}
+		u.SetGroupVersionKind(gvks[0])
+	}
+	return u, nil
+}
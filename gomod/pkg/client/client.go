@@ -0,0 +1,164 @@
+// Package client manages SAE resources from Go with the clients of client-go, independent of the saectl command line:
+//
+//	c, err := client.New(client.Options{Region: "cn-hangzhou", Namespace: "cn-hangzhou:demo"})
+//	deployments, err := c.Kubernetes().AppsV1().Deployments(c.Namespace()).List(ctx, metav1.ListOptions{})
+//	_, err = c.Apply(ctx, deployment)
+//	err = c.Scale(ctx, "deployments", "web", 3)
+//	err = c.Wait(ctx, "deployments", "web", client.RolloutComplete)
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+
+	"saectl/pkg/config"
+	"saectl/pkg/proxy"
+)
+
+// Options configure a Client, the zero value resolves everything like saectl without flags does.
+type Options struct {
+	// AccessKeyId, AccessKeySecret and StsToken are the credentials. When empty, the credential chain of saectl
+	// is consulted: environment, aliyun cli profile, saectl config file, OIDC token file, ECS RAM role and credentials URI
+	AccessKeyId     string
+	AccessKeySecret string
+	StsToken        string
+	// Credential takes precedence over the access key and the chain, e.g. for a credential refreshed by the caller
+	Credential auth.Credential
+	// RoleArn is assumed with the credentials, RoleSessionName and RoleDuration default like the flags of saectl
+	RoleArn         string
+	RoleSessionName string
+	RoleDuration    time.Duration
+
+	Region string
+	// Namespace is the default SAE namespace of namespaced resources, e.g. cn-hangzhou:demo
+	Namespace string
+	// Server overrides the SAE endpoint of Region
+	Server string
+	// Context selects a context of ConfigFile, which defaults to $SAECONFIG or ~/.sae/config
+	Context    string
+	ConfigFile string
+
+	// Retry defaults to proxy.NewDefaultRetryPolicy, set MaxRetries to 0 to disable retrying
+	Retry *proxy.RetryPolicy
+	// QPS and Burst limit all requests of the Client together, zero values take the defaults of saectl
+	QPS   float32
+	Burst int
+	// Timeout bounds every request, zero means no timeout
+	Timeout time.Duration
+	// DisableCompression sends and accepts plain envelope contents only
+	DisableCompression bool
+	// UserAgent is appended to the User-Agent of saectl to identify the caller
+	UserAgent string
+	// TransportOptions customize the envelope pipeline, see proxy.NewTransport
+	TransportOptions []proxy.TransportOption
+}
+
+// Client bundles the clients of one SAE account and region, it is safe for concurrent use.
+type Client struct {
+	config     *rest.Config
+	namespace  string
+	kubernetes kubernetes.Interface
+	dynamic    dynamic.Interface
+	mapper     meta.RESTMapper
+}
+
+func New(opts Options) (*Client, error) {
+	retry := opts.Retry
+	if retry == nil {
+		retry = proxy.NewDefaultRetryPolicy()
+	}
+	builder := config.NewClientConfigBuilder().
+		WithRegion(opts.Region).
+		WithAccessKeyId(opts.AccessKeyId).
+		WithAccessKeySecret(opts.AccessKeySecret).
+		WithStsToken(opts.StsToken).
+		WithAssumeRole(opts.RoleArn, opts.RoleSessionName, opts.RoleDuration).
+		WithClusterServer(opts.Server).
+		WithNamespace(opts.Namespace).
+		WithContext(opts.Context).
+		WithConfigFile(opts.ConfigFile).
+		WithRetryPolicy(retry).
+		WithRateLimit(opts.QPS, opts.Burst).
+		WithDisableCompression(opts.DisableCompression).
+		WithTransportOptions(opts.TransportOptions...)
+	if opts.Credential != nil {
+		builder.WithCredential(opts.Credential)
+	}
+	if opts.Timeout != 0 {
+		builder.WithRequestTimeout(opts.Timeout.String())
+	}
+	clientConfig, err := builder.ToClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.UserAgent) != 0 {
+		restConfig.UserAgent = fmt.Sprintf("%s %s", restConfig.UserAgent, opts.UserAgent)
+	}
+	// the transport limits all requests together, the per client limiters of client-go would only add up
+	restConfig.QPS = -1
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, err
+	}
+	return NewForConfig(restConfig, namespace)
+}
+
+// NewForConfig creates a Client for a config whose transport already speaks to SAE, e.g. one of saectl.
+func NewForConfig(restConfig *rest.Config, namespace string) (*Client, error) {
+	kube, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dyn, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	return &Client{
+		config:     restConfig,
+		namespace:  namespace,
+		kubernetes: kube,
+		dynamic:    dyn,
+		mapper:     restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(cached), cached),
+	}, nil
+}
+
+// RESTConfig returns a copy of the config of the clients, e.g. to create further typed clients.
+func (c *Client) RESTConfig() *rest.Config {
+	return rest.CopyConfig(c.config)
+}
+
+// Namespace is the default namespace of the helpers.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+func (c *Client) Kubernetes() kubernetes.Interface {
+	return c.kubernetes
+}
+
+func (c *Client) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
+
+// RESTMapper maps kinds and resources, including short names like deploy, discovery is cached for the life of the Client.
+func (c *Client) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Condition reports whether Wait is done, obj is nil once the object does not exist.
+// An error ends the wait.
+type Condition func(obj *unstructured.Unstructured) (bool, error)
+
+// Deleted is met once the object does not exist.
+func Deleted(obj *unstructured.Unstructured) (bool, error) {
+	return obj == nil, nil
+}
+
+// ConditionTrue is met once the status condition conditionType is True, e.g. Available of a deployment.
+func ConditionTrue(conditionType string) Condition {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		if obj == nil {
+			return false, nil
+		}
+		conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		if err != nil {
+			return false, err
+		}
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if ok && condition["type"] == conditionType {
+				return condition["status"] == string(metav1.ConditionTrue), nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// RolloutComplete is met once all replicas of a deployment run its latest spec, like `saectl rollout status`.
+func RolloutComplete(obj *unstructured.Unstructured) (bool, error) {
+	if obj == nil {
+		return false, nil
+	}
+	generation, _, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if generation < obj.GetGeneration() {
+		return false, nil
+	}
+	replicas, found, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	updated, _, _ := unstructured.NestedInt64(obj.Object, "status", "updatedReplicas")
+	total, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+	available, _, _ := unstructured.NestedInt64(obj.Object, "status", "availableReplicas")
+	return updated >= replicas && total <= updated && available >= updated, nil
+}
+
+// Wait polls an object until condition is met or ctx is done, see PollInterval.
+func (c *Client) Wait(ctx context.Context, resource, name string, condition Condition, opts ...Option) error {
+	o := newCallOptions(opts)
+	client, _, err := c.resource(resource, o.namespace)
+	if err != nil {
+		return err
+	}
+	err = wait.PollImmediateUntilWithContext(ctx, o.pollInterval, func(ctx context.Context) (bool, error) {
+		obj, err := client.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return condition(nil)
+		}
+		if err != nil {
+			return false, err
+		}
+		return condition(obj)
+	})
+	if err != nil {
+		return fmt.Errorf("fail to wait for %s %s: %w", resource, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/credentials"
+	"k8s.io/client-go/util/homedir"
+)
+
+const (
+	// AliyunProfileEnv selects the aliyun CLI profile when --profile is not given
+	AliyunProfileEnv = "ALIBABA_CLOUD_PROFILE"
+	// AliyunConfigFileEnv overrides the location of the aliyun CLI config file
+	AliyunConfigFileEnv = "ALIBABA_CLOUD_CONFIG_FILE"
+
+	defaultRoleSessionName = "saectl"
+)
+
+// Authentication modes of the aliyun CLI profiles supported by saectl.
+const (
+	AliyunModeAK         = "AK"
+	AliyunModeStsToken   = "StsToken"
+	AliyunModeRamRoleArn = "RamRoleArn"
+	AliyunModeEcsRamRole = "EcsRamRole"
+)
+
+// AliyunConfig is the config file written by the aliyun CLI, usually ~/.aliyun/config.json.
+type AliyunConfig struct {
+	Current  string          `json:"current"`
+	Profiles []AliyunProfile `json:"profiles"`
+}
+
+type AliyunProfile struct {
+	Name            string `json:"name"`
+	Mode            string `json:"mode"`
+	AccessKeyId     string `json:"access_key_id"`
+	AccessKeySecret string `json:"access_key_secret"`
+	StsToken        string `json:"sts_token"`
+	RamRoleName     string `json:"ram_role_name"`
+	RamRoleArn      string `json:"ram_role_arn"`
+	RamSessionName  string `json:"ram_session_name"`
+	ExpiredSeconds  int    `json:"expired_seconds"`
+	RegionId        string `json:"region_id"`
+}
+
+// AliyunConfigFile returns the location of the aliyun CLI config file.
+func AliyunConfigFile() string {
+	if f := os.Getenv(AliyunConfigFileEnv); f != "" {
+		return f
+	}
+	return filepath.Join(homedir.HomeDir(), ".aliyun", "config.json")
+}
+
+// LoadAliyunProfile reads the named profile from the aliyun CLI config file,
+// the current profile of the file is used if name is empty.
+func LoadAliyunProfile(filename, name string) (*AliyunProfile, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read aliyun cli config: %w", err)
+	}
+	c := new(AliyunConfig)
+	if err = json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("fail to parse aliyun cli config %s: %v", filename, err)
+	}
+	if len(name) == 0 {
+		name = c.Current
+	}
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("profile %q not found in %s", name, filename)
+}
+
+// Credential converts the profile into a credential understood by the POP sdk.
+func (p *AliyunProfile) Credential() (auth.Credential, error) {
+	switch p.Mode {
+	case AliyunModeAK:
+		return credentials.NewAccessKeyCredential(p.AccessKeyId, p.AccessKeySecret), nil
+	case AliyunModeStsToken:
+		return credentials.NewStsTokenCredential(p.AccessKeyId, p.AccessKeySecret, p.StsToken), nil
+	case AliyunModeRamRoleArn:
+		sessionName := p.RamSessionName
+		if len(sessionName) == 0 {
+			sessionName = defaultRoleSessionName
+		}
+		return credentials.NewRamRoleArnCredential(p.AccessKeyId, p.AccessKeySecret, p.RamRoleArn, sessionName, p.ExpiredSeconds), nil
+	case AliyunModeEcsRamRole:
+		return credentials.NewEcsRamRoleCredential(p.RamRoleName), nil
+	default:
+		return nil, fmt.Errorf("aliyun cli profile %q uses mode %q which is not supported, supported modes are %s, %s, %s and %s",
+			p.Name, p.Mode, AliyunModeAK, AliyunModeStsToken, AliyunModeRamRoleArn, AliyunModeEcsRamRole)
+	}
+}
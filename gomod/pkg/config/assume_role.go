@@ -0,0 +1,171 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+)
+
+const (
+	DefaultRoleDuration = time.Hour
+	MinRoleDuration     = 15 * time.Minute
+	MaxRoleDuration     = 12 * time.Hour
+
+	stsDomain = "sts.aliyuncs.com"
+)
+
+// AssumeRoleOptions describes the RAM role assumed on top of the credentials found by the chain.
+type AssumeRoleOptions struct {
+	RoleArn     string
+	SessionName string
+	Duration    time.Duration
+}
+
+func (o *AssumeRoleOptions) Validate() error {
+	if o.Duration != 0 && (o.Duration < MinRoleDuration || o.Duration > MaxRoleDuration) {
+		return fmt.Errorf("role duration %v is out of range, must be between %v and %v", o.Duration, MinRoleDuration, MaxRoleDuration)
+	}
+	return nil
+}
+
+// NewAssumeRoleCredential returns a session credential minted by AssumeRole with the source credential,
+// sessions are shared between invocations through the cache until shortly before they expire.
+// sourceIdentity names the principal of source without a secret, it keys the cache together with the
+// role, so it must not change while the access keys of a temporary source rotate.
+func NewAssumeRoleCredential(region string, source auth.Credential, sourceIdentity string, o AssumeRoleOptions, cache *SessionCache) (*SessionCredential, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	if len(o.SessionName) == 0 {
+		o.SessionName = defaultRoleSessionName
+	}
+	if o.Duration == 0 {
+		o.Duration = DefaultRoleDuration
+	}
+	key := cacheKey(o.RoleArn, o.SessionName, sourceIdentity)
+	return NewSessionCredential(func() (*Session, error) {
+		if session, ok := cache.Get(key); ok {
+			return session, nil
+		}
+		session, err := assumeRole(region, source, o)
+		if err != nil {
+			return nil, err
+		}
+		if err = cache.Put(key, session); err != nil {
+			return nil, fmt.Errorf("fail to cache sts session: %w", err)
+		}
+		return session, nil
+	}), nil
+}
+
+func assumeRole(region string, source auth.Credential, o AssumeRoleOptions) (*Session, error) {
+	cli, err := newSDKClient(region, source)
+	if err != nil {
+		return nil, err
+	}
+	req := requests.NewCommonRequest()
+	req.Scheme = "https"
+	req.Domain = stsDomain
+	if endpoint := os.Getenv(AlibabaCloudSTSEndpointEnv); endpoint != "" {
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			req.Scheme, req.Domain = u.Scheme, u.Host
+		}
+	}
+	req.Version = "2015-04-01"
+	req.ApiName = "AssumeRole"
+	req.QueryParams["RoleArn"] = o.RoleArn
+	req.QueryParams["RoleSessionName"] = o.SessionName
+	req.QueryParams["DurationSeconds"] = fmt.Sprintf("%d", int(o.Duration.Seconds()))
+	resp, err := withSession(cli, source).ProcessCommonRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("fail to assume role %s: %w", o.RoleArn, err)
+	}
+	out := new(sessionResponse)
+	if err = json.Unmarshal(resp.GetHttpContentBytes(), out); err != nil {
+		return nil, fmt.Errorf("fail to decode AssumeRole response: %s", resp.GetHttpContentString())
+	}
+	return out.session()
+}
+
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])[:32]
+}
+
+// SessionCache persists STS sessions under the cache dir, readable by the owner only.
+type SessionCache struct {
+	Dir string
+}
+
+func NewSessionCache(cacheDir string) *SessionCache {
+	return &SessionCache{Dir: filepath.Join(cacheDir, "sts")}
+}
+
+func (s *SessionCache) path(key string) string {
+	return filepath.Join(s.Dir, key+".json")
+}
+
+// Get returns the cached session unless it is missing, unreadable or about to expire.
+func (s *SessionCache) Get(key string) (*Session, bool) {
+	if s == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	session := new(Session)
+	if err = json.Unmarshal(data, session); err != nil || session.expired(time.Now()) {
+		return nil, false
+	}
+	return session, true
+}
+
+func (s *SessionCache) Put(key string, session *Session) error {
+	if s == nil {
+		return nil
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	// write to a temp file first so concurrent invocations never read a partial session
+	tmp, err := os.CreateTemp(s.Dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+// Clear removes every cached session.
+func (s *SessionCache) Clear() error {
+	err := os.RemoveAll(s.Dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/credentials"
+)
+
+// TestAssumeRoleCacheSurvivesRotation builds twice with a source whose temporary access key rotates
+// between the builds, the second build must reuse the cached role session.
+func TestAssumeRoleCacheSurvivesRotation(t *testing.T) {
+	var sourceFetches, assumed int32
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&sourceFetches, 1)
+		fmt.Fprintf(w, `{"AccessKeyId":"STS.source-%d","AccessKeySecret":"secret","SecurityToken":"token","Expiration":%q}`,
+			n, time.Now().Add(time.Minute).UTC().Format(time.RFC3339))
+	}))
+	defer source.Close()
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&assumed, 1)
+		fmt.Fprintf(w, `{"RequestId":"1","Credentials":%s}`, sessionJSON)
+	}))
+	defer sts.Close()
+	t.Setenv(AlibabaCloudSTSEndpointEnv, sts.URL)
+
+	cacheDir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		config, err := NewClientConfigBuilder().
+			WithRegion("cn-hangzhou").
+			WithConfigFile(filepath.Join(cacheDir, "config")).
+			WithCacheDir(cacheDir).
+			WithCredentialChain(CredentialChain{&URIProvider{URI: source.URL}}).
+			WithAssumeRole("acs:ram::123:role/sae", "", 0).
+			Build()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if i == 0 && (atomic.LoadInt32(&sourceFetches) != 0 || atomic.LoadInt32(&assumed) != 0) {
+			t.Errorf("expected no request while building, got %d source fetches and %d AssumeRole calls", sourceFetches, assumed)
+		}
+		checkSession(t, getSession(t, config.Credential))
+	}
+	if sourceFetches != 1 || assumed != 1 {
+		t.Errorf("expected the role session to be cached across the rotation, got %d source fetches and %d AssumeRole calls", sourceFetches, assumed)
+	}
+}
+
+func TestSourceIdentity(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *ClientConfigBuilder
+		want    string
+	}{
+		{
+			name:    "long-term access key",
+			builder: &ClientConfigBuilder{ClientConfigOption: ClientConfigOption{CredentialSource: CredentialSourceEnv, Credential: credentials.NewAccessKeyCredential("LTAI.id", "secret")}},
+			want:    "env:LTAI.id",
+		},
+		{
+			name:    "aliyun profile",
+			builder: &ClientConfigBuilder{ClientConfigOption: ClientConfigOption{CredentialSource: CredentialSourceProfile, Credential: credentials.NewStsTokenCredential("STS.id", "secret", "token")}, profile: &AliyunProfile{Name: "prod"}},
+			want:    "profile:prod",
+		},
+		{
+			name:    "context",
+			builder: &ClientConfigBuilder{ClientConfigOption: ClientConfigOption{CredentialSource: CredentialSourceConfig, CurrentContext: "prod", Credential: credentials.NewAccessKeyCredential("LTAI.id", "secret")}},
+			want:    "config:prod:LTAI.id",
+		},
+		{
+			name:    "temporary keys of a remote source",
+			builder: &ClientConfigBuilder{ClientConfigOption: ClientConfigOption{CredentialSource: CredentialSourceECS, Credential: NewSessionCredential(nil)}},
+			want:    "ecs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.builder.sourceIdentity(); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -4,11 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/credentials"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
 	"saectl/pkg/proxy"
+	"saectl/version"
+	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -34,6 +40,31 @@ type ClientConfigOption struct {
 	AccessKeySecret  string
 	StsToken         string
 	ClusterServer    string
+	// Credential is resolved by the credential chain, it takes precedence over the access key pair
+	Credential auth.Credential
+	// CredentialSource forces a single source on the builder, and names the winning source on the config
+	CredentialSource string
+	// RoleArn is the RAM role assumed with the credentials of the source, if any
+	RoleArn string
+	// Record and Replay name a cassette of the POP requests, see proxy.Recorder and proxy.Replayer
+	Record      string
+	Replay      string
+	ReplayMatch proxy.MatchMode
+	// Retry is applied to every POP request when set
+	Retry *proxy.RetryPolicy
+	// Timeout bounds every request, zero means no timeout
+	Timeout time.Duration
+	// Tracer records every request when set
+	Tracer *proxy.Tracer
+	// Auditor records every mutating request when set
+	Auditor *proxy.Auditor
+	// QPS and Burst limit all requests to SAE together, a negative QPS disables the limit
+	QPS   float32
+	Burst int
+	// TransportOptions customize the envelope pipeline, see proxy.NewTransport
+	TransportOptions []proxy.TransportOption
+	// DisableCompression sends and accepts plain envelope contents only
+	DisableCompression bool
 }
 
 var _ clientcmd.ClientConfig = &ClientConfigBuilder{}
@@ -41,6 +72,22 @@ var _ clientcmd.ClientConfig = &ClientConfigBuilder{}
 type ClientConfigBuilder struct {
 	ClientConfigOption
 
+	// ConfigFile is the saectl config file consulted when flags and env are empty
+	ConfigFile string
+	// AliyunProfile selects a profile of the aliyun cli config file
+	AliyunProfile     string
+	AliyunProfileFile string
+	// Chain replaces the default credential chain when set
+	Chain CredentialChain
+	// AssumeRole is applied when RoleArn is set, sessions are cached under CacheDir
+	AssumeRole AssumeRoleOptions
+	CacheDir   string
+	// RequestTimeout is parsed into Timeout like the --request-timeout flag of kubectl, e.g. 30s or 30
+	RequestTimeout string
+
+	profile           *AliyunProfile
+	contextCredential *Credential
+
 	config *ClientConfig
 
 	lock sync.Mutex
@@ -67,6 +114,14 @@ func (c *ClientConfigBuilder) getConfig() error {
 	return nil
 }
 
+// ToClientConfig returns the config, building it on first use.
+func (c *ClientConfigBuilder) ToClientConfig() (*ClientConfig, error) {
+	if err := c.getConfig(); err != nil {
+		return nil, err
+	}
+	return c.config, nil
+}
+
 func (c *ClientConfigBuilder) RawConfig() (clientcmdapi.Config, error) {
 	if err := c.getConfig(); err != nil {
 		return clientcmdapi.Config{}, err
@@ -89,7 +144,11 @@ func (c *ClientConfigBuilder) Namespace() (string, bool, error) {
 }
 
 func (c *ClientConfigBuilder) ConfigAccess() clientcmd.ConfigAccess {
-	return nil
+	return c.FileAccess()
+}
+
+func (c *ClientConfigBuilder) FileAccess() *FileAccess {
+	return NewFileAccess(c.ConfigFile)
 }
 
 func (c *ClientConfigBuilder) WithRegion(region string) *ClientConfigBuilder {
@@ -122,13 +181,269 @@ func (c *ClientConfigBuilder) WithClusterServer(endpoint string) *ClientConfigBu
 	return c
 }
 
+func (c *ClientConfigBuilder) WithContext(name string) *ClientConfigBuilder {
+	c.CurrentContext = name
+	return c
+}
+
+func (c *ClientConfigBuilder) WithConfigFile(path string) *ClientConfigBuilder {
+	c.ConfigFile = path
+	return c
+}
+
+func (c *ClientConfigBuilder) WithAliyunProfile(name string) *ClientConfigBuilder {
+	c.AliyunProfile = name
+	return c
+}
+
+func (c *ClientConfigBuilder) WithAliyunProfileFile(path string) *ClientConfigBuilder {
+	c.AliyunProfileFile = path
+	return c
+}
+
+// WithCredential skips the credential chain, e.g. for a credential refreshed by the caller.
+func (c *ClientConfigBuilder) WithCredential(credential auth.Credential) *ClientConfigBuilder {
+	c.Credential = credential
+	return c
+}
+
+func (c *ClientConfigBuilder) WithCredentialSource(source string) *ClientConfigBuilder {
+	c.CredentialSource = source
+	return c
+}
+
+func (c *ClientConfigBuilder) WithCredentialChain(chain CredentialChain) *ClientConfigBuilder {
+	c.Chain = chain
+	return c
+}
+
+func (c *ClientConfigBuilder) WithAssumeRole(roleArn, sessionName string, duration time.Duration) *ClientConfigBuilder {
+	c.RoleArn = roleArn
+	c.AssumeRole = AssumeRoleOptions{RoleArn: roleArn, SessionName: sessionName, Duration: duration}
+	return c
+}
+
+func (c *ClientConfigBuilder) WithCacheDir(dir string) *ClientConfigBuilder {
+	c.CacheDir = dir
+	return c
+}
+
+func (c *ClientConfigBuilder) WithRecord(filename string) *ClientConfigBuilder {
+	c.Record = filename
+	return c
+}
+
+func (c *ClientConfigBuilder) WithReplay(filename string, match proxy.MatchMode) *ClientConfigBuilder {
+	c.Replay, c.ReplayMatch = filename, match
+	return c
+}
+
+func (c *ClientConfigBuilder) WithRetryPolicy(policy *proxy.RetryPolicy) *ClientConfigBuilder {
+	c.Retry = policy
+	return c
+}
+
+func (c *ClientConfigBuilder) WithTracer(tracer *proxy.Tracer) *ClientConfigBuilder {
+	c.Tracer = tracer
+	return c
+}
+
+func (c *ClientConfigBuilder) WithAuditor(auditor *proxy.Auditor) *ClientConfigBuilder {
+	c.Auditor = auditor
+	return c
+}
+
+func (c *ClientConfigBuilder) WithTransportOptions(opts ...proxy.TransportOption) *ClientConfigBuilder {
+	c.TransportOptions = append(c.TransportOptions, opts...)
+	return c
+}
+
+// WithRateLimit sets the limit of all requests, zero values fall back to the context and then to the defaults.
+func (c *ClientConfigBuilder) WithRateLimit(qps float32, burst int) *ClientConfigBuilder {
+	c.QPS, c.Burst = qps, burst
+	return c
+}
+
+func (c *ClientConfigBuilder) WithDisableCompression(disable bool) *ClientConfigBuilder {
+	c.DisableCompression = disable
+	return c
+}
+
+func (c *ClientConfigBuilder) WithRequestTimeout(timeout string) *ClientConfigBuilder {
+	c.RequestTimeout = timeout
+	return c
+}
+
+// SessionCache returns the cache of assumed role sessions, nil if no cache dir is set.
+func (c *ClientConfigBuilder) SessionCache() *SessionCache {
+	if len(c.CacheDir) == 0 {
+		return nil
+	}
+	return NewSessionCache(c.CacheDir)
+}
+
+// loadAliyunProfile reads the selected aliyun cli profile, its region is used if none is given.
+func (c *ClientConfigBuilder) loadAliyunProfile() error {
+	if len(c.AliyunProfile) == 0 {
+		return nil
+	}
+	filename := c.AliyunProfileFile
+	if len(filename) == 0 {
+		filename = AliyunConfigFile()
+	}
+	profile, err := LoadAliyunProfile(filename, c.AliyunProfile)
+	if err != nil {
+		return err
+	}
+	c.profile = profile
+	if len(c.Region) == 0 {
+		c.Region = profile.RegionId
+	}
+	return nil
+}
+
+// loadConfigFile fills the options left empty by flags and env from the selected context of the config file.
+func (c *ClientConfigBuilder) loadConfigFile() error {
+	saeConfig, err := c.FileAccess().Load()
+	if err != nil {
+		return err
+	}
+	name, ctx, err := saeConfig.GetContext(c.CurrentContext)
+	if err != nil || ctx == nil {
+		return err
+	}
+	c.CurrentContext = name
+	if len(c.Region) == 0 {
+		c.Region = ctx.Region
+	}
+	if len(c.DefaultNamespace) == 0 {
+		c.DefaultNamespace = ctx.Namespace
+	}
+	if len(c.ClusterServer) == 0 {
+		c.ClusterServer = ctx.Server
+	}
+	if c.QPS == 0 {
+		c.QPS = ctx.QPS
+	}
+	if c.Burst == 0 {
+		c.Burst = ctx.Burst
+	}
+	if len(ctx.Credentials) == 0 {
+		return nil
+	}
+	if c.contextCredential, err = saeConfig.GetCredential(ctx.Credentials); err != nil {
+		return fmt.Errorf("context %q: %w", name, err)
+	}
+	return nil
+}
+
+// credentialChain returns the default chain:
+// flags -> env -> aliyun cli profile -> config file -> OIDC token file -> ECS RAM role -> credentials URI.
+func (c *ClientConfigBuilder) credentialChain() CredentialChain {
+	if c.Chain != nil {
+		return c.Chain
+	}
+	return CredentialChain{
+		&StaticProvider{
+			Source:          CredentialSourceFlags,
+			AccessKeyId:     c.AccessKeyId,
+			AccessKeySecret: c.AccessKeySecret,
+			StsToken:        c.StsToken,
+		},
+		NewEnvProvider(),
+		&ProfileProvider{Profile: c.profile},
+		c.contextProvider(),
+		NewOIDCProviderFromEnv(),
+		NewECSProviderFromEnv(),
+		NewURIProviderFromEnv(),
+	}
+}
+
+// contextProvider serves the credentials referenced by the selected context, running its helper if configured.
+func (c *ClientConfigBuilder) contextProvider() CredentialProvider {
+	cred := c.contextCredential
+	if cred != nil && cred.Exec != nil {
+		return &ExecProvider{Source: CredentialSourceConfig, Exec: cred.Exec, Region: c.Region}
+	}
+	provider := &StaticProvider{Source: CredentialSourceConfig}
+	if cred != nil {
+		provider.AccessKeyId, provider.AccessKeySecret, provider.StsToken = cred.AccessKeyId, cred.AccessKeySecret, cred.StsToken
+	}
+	return provider
+}
+
+func (c *ClientConfigBuilder) resolveCredential() error {
+	if c.Credential != nil {
+		return nil
+	}
+	chain := c.credentialChain()
+	if len(c.CredentialSource) != 0 {
+		var err error
+		if chain, err = chain.Only(c.CredentialSource); err != nil {
+			return err
+		}
+	}
+	cred, source, err := chain.Resolve()
+	if err != nil {
+		return err
+	}
+	c.Credential, c.CredentialSource = cred, source
+	return nil
+}
+
+// sourceIdentity names the source of the resolved credential without a network call: the profile or
+// context it was read from, and a long-term access key. Sources handing out temporary keys, like the ECS
+// RAM role or OIDC, are named by the source alone as their keys rotate.
+func (c *ClientConfigBuilder) sourceIdentity() string {
+	identity := []string{c.CredentialSource}
+	switch c.CredentialSource {
+	case CredentialSourceProfile:
+		if c.profile != nil {
+			identity = append(identity, c.profile.Name)
+		}
+	case CredentialSourceConfig:
+		identity = append(identity, c.CurrentContext)
+	}
+	if cred, ok := c.Credential.(*credentials.AccessKeyCredential); ok {
+		identity = append(identity, cred.AccessKeyId)
+	}
+	return strings.Join(identity, ":")
+}
+
 func (c *ClientConfigBuilder) Build() (*ClientConfig, error) {
-	if len(c.AccessKeyId) == 0 || len(c.AccessKeySecret) == 0 {
-		return nil, AccessKeyOrSecretIsEmptyError
+	if len(c.Record) != 0 && len(c.Replay) != 0 {
+		return nil, fmt.Errorf("record and replay are mutually exclusive")
+	}
+	if len(c.RequestTimeout) != 0 {
+		timeout, err := clientcmd.ParseTimeout(c.RequestTimeout)
+		if err != nil {
+			return nil, err
+		}
+		c.Timeout = timeout
+	}
+	if err := c.loadAliyunProfile(); err != nil {
+		return nil, err
+	}
+	if err := c.loadConfigFile(); err != nil {
+		return nil, err
+	}
+	// a replay must not touch the network, so no credential source is consulted and no role assumed
+	if len(c.Replay) != 0 {
+		c.Credential, c.CredentialSource = credentials.NewAccessKeyCredential(CredentialSourceReplay, CredentialSourceReplay), CredentialSourceReplay
+	}
+	if err := c.resolveCredential(); err != nil {
+		return nil, err
 	}
 	if len(c.Region) == 0 {
 		return nil, RegionNotFoundError
 	}
+	if len(c.RoleArn) != 0 && len(c.Replay) == 0 {
+		cred, err := NewAssumeRoleCredential(c.Region, c.Credential, c.sourceIdentity(), c.AssumeRole, c.SessionCache())
+		if err != nil {
+			return nil, err
+		}
+		c.Credential = cred
+	}
 	if len(c.ClusterServer) == 0 {
 		c.ClusterServer = genSAEClusterServerAddress(c.Region)
 	}
@@ -138,23 +453,54 @@ func (c *ClientConfigBuilder) Build() (*ClientConfig, error) {
 	if len(c.ClusterName) == 0 {
 		c.ClusterName = DefaultSAEClusterName
 	}
+	if c.QPS == 0 {
+		c.QPS = proxy.DefaultQPS
+	}
+	if c.Burst == 0 {
+		c.Burst = proxy.DefaultBurst
+	}
 	c.config = &ClientConfig{
 		ClientConfigOption: ClientConfigOption{
-			Region:           c.Region,
-			CurrentContext:   c.CurrentContext,
-			ClusterName:      c.ClusterName,
-			ClusterServer:    c.ClusterServer,
-			AccessKeySecret:  c.AccessKeySecret,
-			AccessKeyId:      c.AccessKeyId,
-			StsToken:         c.StsToken,
-			DefaultNamespace: c.DefaultNamespace,
+			Region:             c.Region,
+			CurrentContext:     c.CurrentContext,
+			ClusterName:        c.ClusterName,
+			ClusterServer:      c.ClusterServer,
+			AccessKeySecret:    c.AccessKeySecret,
+			AccessKeyId:        c.AccessKeyId,
+			StsToken:           c.StsToken,
+			DefaultNamespace:   c.DefaultNamespace,
+			Credential:         c.Credential,
+			CredentialSource:   c.CredentialSource,
+			RoleArn:            c.RoleArn,
+			Record:             c.Record,
+			Replay:             c.Replay,
+			ReplayMatch:        c.ReplayMatch,
+			Retry:              c.Retry,
+			Timeout:            c.Timeout,
+			Tracer:             c.Tracer,
+			Auditor:            c.Auditor,
+			QPS:                c.QPS,
+			Burst:              c.Burst,
+			TransportOptions:   c.TransportOptions,
+			DisableCompression: c.DisableCompression,
 		},
+		compression: &proxy.Compression{Disabled: c.DisableCompression},
+		configFile:  c.ConfigFile,
 	}
 	return c.config, nil
 }
 
 type ClientConfig struct {
 	ClientConfigOption
+
+	// processor is shared by all clients so a cassette is recorded or replayed once per invocation
+	processorOnce sync.Once
+	processor     proxy.Processor
+	processorErr  error
+	// compression is shared by all clients so the server is negotiated with once per invocation
+	compression *proxy.Compression
+	// configFile is the saectl config file the config was built from, empty for the default location
+	configFile string
 }
 
 func (c *ClientConfig) RawConfig() (clientcmdapi.Config, error) {
@@ -171,22 +517,79 @@ func (c *ClientConfig) RawConfig() (clientcmdapi.Config, error) {
 			c.CurrentContext: {
 				Cluster:   c.ClusterName,
 				AuthInfo:  c.CurrentContext,
-				Namespace: c.Region,
+				Namespace: c.DefaultNamespace,
 			},
 		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{
+			c.CurrentContext: {},
+		},
+		CurrentContext: c.CurrentContext,
 	}, nil
 }
 
-func (c *ClientConfig) ClientConfig() (*rest.Config, error) {
-	var (
-		cli *sdk.Client
-		err error
-	)
+// SDKClient returns a POP client signed with the resolved credential, its read and connect timeouts are bounded by Timeout.
+func (c *ClientConfig) SDKClient() (proxy.Processor, error) {
+	cli, err := c.newSDKClient()
+	if err != nil {
+		return nil, err
+	}
+	if c.Timeout != 0 {
+		cli.SetReadTimeout(c.Timeout)
+		cli.SetConnectTimeout(c.Timeout)
+	}
+	return withSession(cli, c.Credential), nil
+}
+
+func (c *ClientConfig) newSDKClient() (*sdk.Client, error) {
+	if c.Credential != nil {
+		return newSDKClient(c.Region, c.Credential)
+	}
 	if len(c.StsToken) != 0 {
-		cli, err = sdk.NewClientWithStsToken(c.Region, c.AccessKeyId, c.AccessKeySecret, c.StsToken)
-	} else {
-		cli, err = sdk.NewClientWithAccessKey(c.Region, c.AccessKeyId, c.AccessKeySecret)
+		return sdk.NewClientWithStsToken(c.Region, c.AccessKeyId, c.AccessKeySecret, c.StsToken)
 	}
+	return sdk.NewClientWithAccessKey(c.Region, c.AccessKeyId, c.AccessKeySecret)
+}
+
+func newSDKClient(region string, credential auth.Credential) (*sdk.Client, error) {
+	if _, ok := credential.(*SessionCredential); !ok {
+		return sdk.NewClientWithOptions(region, sdk.NewConfig(), credential)
+	}
+	// the sdk cannot sign with a refreshable session, the requests are signed by withSession
+	return sdk.NewClientWithOptions(region, sdk.NewConfig(), credentials.NewAccessKeyCredential("", ""))
+}
+
+// Processor returns the SDK client, wrapped to record or replay a cassette, to limit the rate and to retry if configured.
+// Retries wrap the others so that every attempt is limited and recorded.
+func (c *ClientConfig) Processor() (proxy.Processor, error) {
+	c.processorOnce.Do(func() {
+		c.processor, c.processorErr = c.newProcessor()
+		// a replay makes no network calls, so there is nothing to protect
+		if c.processorErr == nil && c.QPS > 0 && len(c.Replay) == 0 {
+			c.processor = proxy.NewRateLimiter(c.processor, c.QPS, c.Burst)
+		}
+		if c.processorErr == nil && c.Retry != nil && c.Retry.MaxRetries > 0 {
+			c.processor = proxy.NewRetrier(c.processor, c.Retry)
+		}
+	})
+	return c.processor, c.processorErr
+}
+
+func (c *ClientConfig) newProcessor() (proxy.Processor, error) {
+	if len(c.Replay) != 0 {
+		return proxy.NewReplayer(c.Replay, c.ReplayMatch)
+	}
+	cli, err := c.SDKClient()
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Record) != 0 {
+		return proxy.NewRecorder(c.Record, cli)
+	}
+	return cli, nil
+}
+
+func (c *ClientConfig) ClientConfig() (*rest.Config, error) {
+	cli, err := c.Processor()
 	if err != nil {
 		return nil, err
 	}
@@ -194,13 +597,52 @@ func (c *ClientConfig) ClientConfig() (*rest.Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	// a server without scheme is an SAE endpoint, which is only reachable over https
+	host := rawConfig.Clusters[c.ClusterName].Server
+	if !strings.Contains(host, "://") {
+		host = proxy.OpenAPIScheme + "://" + host
+	}
+	opts := append([]proxy.TransportOption{proxy.WithCompression(c.compression)}, c.TransportOptions...)
+	wrapTransport := proxy.NewTransportWrapper(cli, opts...)
+	// the auditor is wrapped inside the tracer, so it shares the trace of a request, a replay changes nothing to audit
+	if c.Auditor != nil && len(c.Replay) == 0 {
+		wrapTransport = transport.Wrappers(wrapTransport, c.Auditor.WrapperFor(c.auditAccount()))
+	}
+	if c.Tracer != nil {
+		wrapTransport = transport.Wrappers(wrapTransport, c.Tracer.WrapTransport)
+	}
 	return &rest.Config{
-		Host:          rawConfig.Clusters[c.ClusterName].Server,
-		WrapTransport: proxy.NewTransportWrapper(cli),
+		Host:          host,
+		UserAgent:     version.UserAgent(),
+		Timeout:       c.Timeout,
+		WrapTransport: wrapTransport,
 	}, nil
 
 }
 
+// auditAccount identifies the account of the requests without a network call,
+// the access key of an assumed role is temporary, so the role stands for it.
+func (c *ClientConfig) auditAccount() proxy.AuditAccount {
+	account := proxy.AuditAccount{CredentialSource: c.CredentialSource, RoleArn: c.RoleArn, Region: c.Region}
+	if len(c.RoleArn) == 0 {
+		account.AccessKeyId, _ = CredentialAccessKeyId(c.Credential)
+	}
+	return account
+}
+
+// LocalTokenScope identifies the context and the identity a local token is issued for, so a token handed
+// out for one of them is not accepted by a gateway serving another. Temporary access keys rotate, only a
+// long-term one stands for the identity.
+func (c *ClientConfig) LocalTokenScope() string {
+	scope := []string{c.CurrentContext, c.Region, c.CredentialSource, c.RoleArn}
+	if cred, ok := c.Credential.(*credentials.AccessKeyCredential); ok {
+		scope = append(scope, cred.AccessKeyId)
+	} else if c.Credential == nil {
+		scope = append(scope, c.AccessKeyId)
+	}
+	return strings.Join(scope, "\x00")
+}
+
 func (c *ClientConfig) Namespace() (string, bool, error) {
 	if c.DefaultNamespace == "" {
 		return "default", false, nil
@@ -209,7 +651,7 @@ func (c *ClientConfig) Namespace() (string, bool, error) {
 }
 
 func (c *ClientConfig) ConfigAccess() clientcmd.ConfigAccess {
-	return nil
+	return NewFileAccess(c.configFile)
 }
 
 var _ clientcmd.ClientConfig = &ClientConfig{}
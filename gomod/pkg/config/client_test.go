@@ -0,0 +1,40 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestClientConfigAccess(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(SAEConfigEnv, filepath.Join(dir, "env-config"))
+	tests := []struct {
+		name       string
+		configFile string
+		want       string
+	}{
+		{name: "explicit file", configFile: filepath.Join(dir, "config"), want: filepath.Join(dir, "config")},
+		{name: "recommended file", want: filepath.Join(dir, "env-config")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := NewClientConfigBuilder().
+				WithRegion("cn-hangzhou").
+				WithAccessKeyId("id").
+				WithAccessKeySecret("secret").
+				WithConfigFile(tt.configFile).
+				WithCacheDir(dir).
+				Build()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			access := config.ConfigAccess()
+			if access == nil {
+				t.Fatal("expected the access of the config file, got nil")
+			}
+			if got := access.GetDefaultFilename(); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
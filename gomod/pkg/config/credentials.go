@@ -0,0 +1,248 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/credentials"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/signers"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+
+	"saectl/pkg/proxy"
+)
+
+// Credential sources, in the order the default chain consults them.
+const (
+	CredentialSourceFlags   = "flags"
+	CredentialSourceEnv     = "env"
+	CredentialSourceProfile = "profile"
+	CredentialSourceConfig  = "config"
+	CredentialSourceOIDC    = "oidc"
+	CredentialSourceECS     = "ecs"
+	CredentialSourceURI     = "uri"
+
+	// CredentialSourceReplay stands in for the chain while replaying a cassette
+	CredentialSourceReplay = "replay"
+)
+
+const (
+	AliCloudAccessKeyEnv = "ALICLOUD_ACCESS_KEY"
+	AliCloudSecretKeyEnv = "ALICLOUD_SECRET_KEY"
+	AliCloudStsTokenEnv  = "ALICLOUD_STS_TOKEN"
+	AliCloudRegionEnv    = "ALICLOUD_REGION"
+
+	AlibabaCloudAccessKeyIdEnv     = "ALIBABA_CLOUD_ACCESS_KEY_ID"
+	AlibabaCloudAccessKeySecretEnv = "ALIBABA_CLOUD_ACCESS_KEY_SECRET"
+	AlibabaCloudSecurityTokenEnv   = "ALIBABA_CLOUD_SECURITY_TOKEN"
+)
+
+// NoCredentialsError is returned by a provider whose source is not configured, the chain then moves on.
+var NoCredentialsError = errors.New("no credentials")
+
+// CredentialProvider resolves credentials from a single source.
+type CredentialProvider interface {
+	// Name is the source name accepted by --credential-source.
+	Name() string
+	Resolve() (auth.Credential, error)
+}
+
+// CredentialChain consults its providers in order and returns the first credential found.
+type CredentialChain []CredentialProvider
+
+func (c CredentialChain) Resolve() (auth.Credential, string, error) {
+	for _, provider := range c {
+		cred, err := provider.Resolve()
+		if errors.Is(err, NoCredentialsError) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("credential source %q: %w", provider.Name(), err)
+		}
+		return cred, provider.Name(), nil
+	}
+	return nil, "", AccessKeyOrSecretIsEmptyError
+}
+
+// Only narrows the chain down to the named source.
+func (c CredentialChain) Only(name string) (CredentialChain, error) {
+	var names []string
+	for _, provider := range c {
+		if provider.Name() == name {
+			return CredentialChain{forcedProvider{provider}}, nil
+		}
+		names = append(names, provider.Name())
+	}
+	return nil, fmt.Errorf("unknown credential source %q, must be one of %s", name, strings.Join(names, "|"))
+}
+
+// forcedProvider turns a missing source into an error instead of falling through.
+type forcedProvider struct {
+	CredentialProvider
+}
+
+func (p forcedProvider) Resolve() (auth.Credential, error) {
+	cred, err := p.CredentialProvider.Resolve()
+	if errors.Is(err, NoCredentialsError) {
+		return nil, fmt.Errorf("source is not configured")
+	}
+	return cred, err
+}
+
+// StaticProvider serves a fixed access key pair and optional STS token.
+type StaticProvider struct {
+	Source          string
+	AccessKeyId     string
+	AccessKeySecret string
+	StsToken        string
+}
+
+func (p *StaticProvider) Name() string {
+	return p.Source
+}
+
+func (p *StaticProvider) Resolve() (auth.Credential, error) {
+	if len(p.AccessKeyId) == 0 && len(p.AccessKeySecret) == 0 {
+		return nil, NoCredentialsError
+	}
+	if len(p.AccessKeyId) == 0 || len(p.AccessKeySecret) == 0 {
+		return nil, AccessKeyOrSecretIsEmptyError
+	}
+	if len(p.StsToken) != 0 {
+		return credentials.NewStsTokenCredential(p.AccessKeyId, p.AccessKeySecret, p.StsToken), nil
+	}
+	return credentials.NewAccessKeyCredential(p.AccessKeyId, p.AccessKeySecret), nil
+}
+
+// NewEnvProvider reads the ALICLOUD_* variables, falling back to the ALIBABA_CLOUD_* ones used by the aliyun tooling.
+func NewEnvProvider() CredentialProvider {
+	return &StaticProvider{
+		Source:          CredentialSourceEnv,
+		AccessKeyId:     firstEnv(AliCloudAccessKeyEnv, AlibabaCloudAccessKeyIdEnv),
+		AccessKeySecret: firstEnv(AliCloudSecretKeyEnv, AlibabaCloudAccessKeySecretEnv),
+		StsToken:        firstEnv(AliCloudStsTokenEnv, AlibabaCloudSecurityTokenEnv),
+	}
+}
+
+func firstEnv(keys ...string) string {
+	for _, key := range keys {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ProfileProvider serves the credentials of the selected aliyun cli profile.
+type ProfileProvider struct {
+	Profile *AliyunProfile
+}
+
+func (p *ProfileProvider) Name() string {
+	return CredentialSourceProfile
+}
+
+func (p *ProfileProvider) Resolve() (auth.Credential, error) {
+	if p.Profile == nil {
+		return nil, NoCredentialsError
+	}
+	return p.Profile.Credential()
+}
+
+// Session is a set of temporary credentials.
+type Session struct {
+	AccessKeyId     string    `json:"AccessKeyId"`
+	AccessKeySecret string    `json:"AccessKeySecret"`
+	SecurityToken   string    `json:"SecurityToken"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// sessionRefreshWindow is how long before expiry a session is renewed.
+const sessionRefreshWindow = 3 * time.Minute
+
+func (s *Session) expired(now time.Time) bool {
+	return !s.Expiration.IsZero() && now.Add(sessionRefreshWindow).After(s.Expiration)
+}
+
+// SessionCredential is a credential minted by a remote source, it is fetched lazily and renewed before expiry.
+type SessionCredential struct {
+	fetch func() (*Session, error)
+
+	lock    sync.Mutex
+	session *Session
+}
+
+func NewSessionCredential(fetch func() (*Session, error)) *SessionCredential {
+	return &SessionCredential{fetch: fetch}
+}
+
+func (s *SessionCredential) Get() (*Session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.session != nil && !s.session.expired(time.Now()) {
+		return s.session, nil
+	}
+	session, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	s.session = session
+	return session, nil
+}
+
+// signer signs with the session, which is fixed for the request being signed.
+func (s *Session) signer() auth.Signer {
+	if len(s.SecurityToken) == 0 {
+		return signers.NewAccessKeySigner(credentials.NewAccessKeyCredential(s.AccessKeyId, s.AccessKeySecret))
+	}
+	return signers.NewStsTokenSigner(credentials.NewStsTokenCredential(s.AccessKeyId, s.AccessKeySecret, s.SecurityToken))
+}
+
+// sessionClient signs every POP request with a single session of a SessionCredential, fetched once per request,
+// so a renewal while the request is signed can't mix the key pairs of two sessions.
+type sessionClient struct {
+	*sdk.Client
+	credential *SessionCredential
+}
+
+func (c *sessionClient) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	session, err := c.credential.Get()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get session credential: %w", err)
+	}
+	return c.Client.ProcessCommonRequestWithSigner(request, session.signer())
+}
+
+// withSession returns cli, signing with the sessions of credential if it is a SessionCredential.
+func withSession(cli *sdk.Client, credential auth.Credential) proxy.Processor {
+	if session, ok := credential.(*SessionCredential); ok {
+		return &sessionClient{Client: cli, credential: session}
+	}
+	return cli
+}
+
+// CredentialAccessKeyId returns the access key id carried by a credential, fetching sessions if needed.
+func CredentialAccessKeyId(cred auth.Credential) (string, error) {
+	switch c := cred.(type) {
+	case *credentials.AccessKeyCredential:
+		return c.AccessKeyId, nil
+	case *credentials.StsTokenCredential:
+		return c.AccessKeyId, nil
+	case *credentials.RamRoleArnCredential:
+		return c.AccessKeyId, nil
+	case *SessionCredential:
+		session, err := c.Get()
+		if err != nil {
+			return "", err
+		}
+		return session.AccessKeyId, nil
+	default:
+		return "", nil
+	}
+}
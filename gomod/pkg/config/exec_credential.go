@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+)
+
+const (
+	// ExecRegionEnv tells the credential helper which region the credentials are used for
+	ExecRegionEnv = "SAECTL_EXEC_REGION"
+
+	execTimeout = 2 * time.Minute
+)
+
+// ExecConfig configures a command which prints credentials as JSON on stdout, e.g.
+//
+//	{"AccessKeyId": "STS.xxx", "AccessKeySecret": "xxx", "SecurityToken": "xxx", "Expiration": "2023-01-01T00:00:00Z"}
+//
+// The command is invoked again once the expiration is near, credentials without expiration are used for the whole invocation.
+type ExecConfig struct {
+	Command string       `json:"command"`
+	Args    []string     `json:"args,omitempty"`
+	Env     []ExecEnvVar `json:"env,omitempty"`
+}
+
+type ExecEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ExecProvider runs a credential helper command.
+type ExecProvider struct {
+	Source string
+	Exec   *ExecConfig
+	Region string
+}
+
+func (p *ExecProvider) Name() string {
+	return p.Source
+}
+
+func (p *ExecProvider) Resolve() (auth.Credential, error) {
+	if p.Exec == nil || len(p.Exec.Command) == 0 {
+		return nil, NoCredentialsError
+	}
+	return NewSessionCredential(p.run), nil
+}
+
+func (p *ExecProvider) run() (*Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Exec.Command, p.Exec.Args...)
+	cmd.Env = append(os.Environ(), ExecRegionEnv+"="+p.Region)
+	for _, env := range p.Exec.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("credential helper %q failed: %v, stderr: %s", p.Exec.Command, err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("fail to run credential helper %q: %w", p.Exec.Command, err)
+	}
+	out := new(sessionResponse)
+	if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+		return nil, fmt.Errorf("credential helper %q printed invalid JSON: %v, stderr: %s", p.Exec.Command, err, strings.TrimSpace(stderr.String()))
+	}
+	session, err := out.session()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %q: %w", p.Exec.Command, err)
+	}
+	return session, nil
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/homedir"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// SAEConfigEnv overrides the location of the saectl config file
+	SAEConfigEnv = "SAECONFIG"
+
+	configKind       = "Config"
+	configAPIVersion = "v1"
+)
+
+var (
+	ContextNotFoundError     = errors.New("context not found")
+	CredentialsNotFoundError = errors.New("credentials not found")
+)
+
+// SAEConfig is the persistent configuration stored in ~/.sae/config,
+// it holds named contexts and the credentials they refer to.
+type SAEConfig struct {
+	Kind           string                 `json:"kind,omitempty"`
+	APIVersion     string                 `json:"apiVersion,omitempty"`
+	CurrentContext string                 `json:"current-context"`
+	Contexts       map[string]*Context    `json:"contexts"`
+	Credentials    map[string]*Credential `json:"credentials"`
+}
+
+// Context binds a credentials entry to a region, a default namespace and an optional endpoint.
+type Context struct {
+	Credentials string `json:"credentials,omitempty"`
+	Region      string `json:"region,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	Server      string `json:"server,omitempty"`
+	// QPS and Burst are the defaults of --qps and --burst
+	QPS   float32 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+type Credential struct {
+	AccessKeyId     string `json:"access-key-id,omitempty"`
+	AccessKeySecret string `json:"access-key-secret,omitempty"`
+	StsToken        string `json:"sts-token,omitempty"`
+	// Exec takes precedence over the static keys when set
+	Exec *ExecConfig `json:"exec,omitempty"`
+}
+
+func NewSAEConfig() *SAEConfig {
+	return &SAEConfig{
+		Kind:        configKind,
+		APIVersion:  configAPIVersion,
+		Contexts:    map[string]*Context{},
+		Credentials: map[string]*Credential{},
+	}
+}
+
+// GetContext returns the named context, or the current context if name is empty.
+// The returned name is empty when no context is selected.
+func (c *SAEConfig) GetContext(name string) (string, *Context, error) {
+	if len(name) == 0 {
+		name = c.CurrentContext
+	}
+	if len(name) == 0 {
+		return "", nil, nil
+	}
+	ctx, ok := c.Contexts[name]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %q", ContextNotFoundError, name)
+	}
+	return name, ctx, nil
+}
+
+func (c *SAEConfig) GetCredential(name string) (*Credential, error) {
+	cred, ok := c.Credentials[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", CredentialsNotFoundError, name)
+	}
+	return cred, nil
+}
+
+// Redacted returns a copy of the config with secrets masked for display.
+func (c *SAEConfig) Redacted() *SAEConfig {
+	out := *c
+	out.Credentials = make(map[string]*Credential, len(c.Credentials))
+	for name, cred := range c.Credentials {
+		redacted := *cred
+		redacted.AccessKeySecret = redact(redacted.AccessKeySecret)
+		redacted.StsToken = redact(redacted.StsToken)
+		out.Credentials[name] = &redacted
+	}
+	return &out
+}
+
+func redact(s string) string {
+	if len(s) == 0 {
+		return s
+	}
+	return "REDACTED"
+}
+
+// ToKubeConfig converts the config to its kubeconfig equivalent, secrets are never copied.
+func (c *SAEConfig) ToKubeConfig() *clientcmdapi.Config {
+	kubeConfig := clientcmdapi.NewConfig()
+	kubeConfig.CurrentContext = c.CurrentContext
+	for name, ctx := range c.Contexts {
+		server := ctx.Server
+		if len(server) == 0 && len(ctx.Region) != 0 {
+			server = genSAEClusterServerAddress(ctx.Region)
+		}
+		cluster := clientcmdapi.NewCluster()
+		cluster.Server = server
+		kubeConfig.Clusters[name] = cluster
+
+		kubeContext := clientcmdapi.NewContext()
+		kubeContext.Cluster = name
+		kubeContext.AuthInfo = ctx.Credentials
+		kubeContext.Namespace = ctx.Namespace
+		kubeConfig.Contexts[name] = kubeContext
+	}
+	for name := range c.Credentials {
+		kubeConfig.AuthInfos[name] = clientcmdapi.NewAuthInfo()
+	}
+	return kubeConfig
+}
+
+// RecommendedConfigFile returns the config file location, honouring SAECONFIG.
+func RecommendedConfigFile() string {
+	if f := os.Getenv(SAEConfigEnv); f != "" {
+		return f
+	}
+	return filepath.Join(homedir.HomeDir(), ".sae", "config")
+}
+
+var _ clientcmd.ConfigAccess = &FileAccess{}
+
+// FileAccess reads and writes the saectl config file.
+type FileAccess struct {
+	ExplicitPath string
+}
+
+func NewFileAccess(path string) *FileAccess {
+	return &FileAccess{ExplicitPath: path}
+}
+
+func (a *FileAccess) GetLoadingPrecedence() []string {
+	return []string{a.GetDefaultFilename()}
+}
+
+func (a *FileAccess) GetStartingConfig() (*clientcmdapi.Config, error) {
+	c, err := a.Load()
+	if err != nil {
+		return nil, err
+	}
+	return c.ToKubeConfig(), nil
+}
+
+func (a *FileAccess) GetDefaultFilename() string {
+	if a.IsExplicitFile() {
+		return a.ExplicitPath
+	}
+	return RecommendedConfigFile()
+}
+
+func (a *FileAccess) IsExplicitFile() bool {
+	return len(a.ExplicitPath) != 0
+}
+
+func (a *FileAccess) GetExplicitFile() string {
+	return a.ExplicitPath
+}
+
+// Load reads the config file, a missing file yields an empty config.
+func (a *FileAccess) Load() (*SAEConfig, error) {
+	filename := a.GetDefaultFilename()
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return NewSAEConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := NewSAEConfig()
+	if err = yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("fail to parse config file %s: %v", filename, err)
+	}
+	if c.Contexts == nil {
+		c.Contexts = map[string]*Context{}
+	}
+	if c.Credentials == nil {
+		c.Credentials = map[string]*Credential{}
+	}
+	return c, nil
+}
+
+// Save writes the config file with owner-only permissions since it may contain secrets.
+func (a *FileAccess) Save(c *SAEConfig) error {
+	filename := a.GetDefaultFilename()
+	c.Kind, c.APIVersion = configKind, configAPIVersion
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0600)
+}
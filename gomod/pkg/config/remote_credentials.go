@@ -0,0 +1,235 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/utils"
+)
+
+const (
+	AlibabaCloudRoleArnEnv         = "ALIBABA_CLOUD_ROLE_ARN"
+	AlibabaCloudOIDCProviderArnEnv = "ALIBABA_CLOUD_OIDC_PROVIDER_ARN"
+	AlibabaCloudOIDCTokenFileEnv   = "ALIBABA_CLOUD_OIDC_TOKEN_FILE"
+	AlibabaCloudRoleSessionNameEnv = "ALIBABA_CLOUD_ROLE_SESSION_NAME"
+	AlibabaCloudSTSEndpointEnv     = "ALIBABA_CLOUD_STS_ENDPOINT"
+	AlibabaCloudECSMetadataEnv     = "ALIBABA_CLOUD_ECS_METADATA"
+	AlibabaCloudECSMetadataOffEnv  = "ALIBABA_CLOUD_ECS_METADATA_DISABLED"
+	AlibabaCloudCredentialsURIEnv  = "ALIBABA_CLOUD_CREDENTIALS_URI"
+
+	DefaultSTSEndpoint         = "https://sts.aliyuncs.com"
+	DefaultECSMetadataEndpoint = "http://100.100.100.200"
+
+	ecsRoleCredentialsPath = "/latest/meta-data/ram/security-credentials/"
+	// ecsProbeTimeout keeps the chain fast outside of ECS where the metadata address is unroutable
+	ecsProbeTimeout   = time.Second
+	remoteCallTimeout = 10 * time.Second
+)
+
+// sessionResponse is the payload shared by STS, the ECS metadata service and credentials URIs.
+type sessionResponse struct {
+	Code        string   `json:"Code"`
+	Message     string   `json:"Message"`
+	Credentials *Session `json:"Credentials"`
+	Session
+}
+
+func (r *sessionResponse) session() (*Session, error) {
+	if r.Credentials != nil {
+		return r.Credentials, nil
+	}
+	if r.Code != "" && r.Code != "Success" {
+		return nil, fmt.Errorf("%s: %s", r.Code, r.Message)
+	}
+	if len(r.AccessKeyId) == 0 || len(r.AccessKeySecret) == 0 {
+		return nil, fmt.Errorf("response carries no access key")
+	}
+	return &r.Session, nil
+}
+
+func fetchSession(client *http.Client, req *http.Request) (*Session, error) {
+	if client == nil {
+		client = &http.Client{Timeout: remoteCallTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	out := new(sessionResponse)
+	if err = json.Unmarshal(data, out); err != nil || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s: status %d, response: %s", req.Method, req.URL.Redacted(), resp.StatusCode, string(data))
+	}
+	return out.session()
+}
+
+// OIDCProvider exchanges a projected service account token for STS credentials (RRSA on ACK).
+type OIDCProvider struct {
+	RoleArn         string
+	OIDCProviderArn string
+	TokenFile       string
+	SessionName     string
+	STSEndpoint     string
+	Client          *http.Client
+}
+
+func NewOIDCProviderFromEnv() *OIDCProvider {
+	return &OIDCProvider{
+		RoleArn:         os.Getenv(AlibabaCloudRoleArnEnv),
+		OIDCProviderArn: os.Getenv(AlibabaCloudOIDCProviderArnEnv),
+		TokenFile:       os.Getenv(AlibabaCloudOIDCTokenFileEnv),
+		SessionName:     os.Getenv(AlibabaCloudRoleSessionNameEnv),
+		STSEndpoint:     os.Getenv(AlibabaCloudSTSEndpointEnv),
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return CredentialSourceOIDC
+}
+
+func (p *OIDCProvider) Resolve() (auth.Credential, error) {
+	if len(p.RoleArn) == 0 || len(p.OIDCProviderArn) == 0 || len(p.TokenFile) == 0 {
+		return nil, NoCredentialsError
+	}
+	return NewSessionCredential(p.fetch), nil
+}
+
+// fetch calls AssumeRoleWithOIDC, which is authenticated by the token itself and needs no signature.
+func (p *OIDCProvider) fetch() (*Session, error) {
+	token, err := os.ReadFile(p.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, sessionName := p.STSEndpoint, p.SessionName
+	if len(endpoint) == 0 {
+		endpoint = DefaultSTSEndpoint
+	}
+	if len(sessionName) == 0 {
+		sessionName = defaultRoleSessionName
+	}
+	query := url.Values{
+		"Action":    {"AssumeRoleWithOIDC"},
+		"Format":    {"JSON"},
+		"Version":   {"2015-04-01"},
+		"Timestamp": {utils.GetTimeInFormatISO8601()},
+	}
+	form := url.Values{
+		"RoleArn":         {p.RoleArn},
+		"OIDCProviderArn": {p.OIDCProviderArn},
+		"OIDCToken":       {strings.TrimSpace(string(token))},
+		"RoleSessionName": {sessionName},
+		"DurationSeconds": {"3600"},
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/?"+query.Encode(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return fetchSession(p.Client, req)
+}
+
+// ECSProvider reads the credentials of the RAM role attached to the ECS instance from the metadata service.
+type ECSProvider struct {
+	// RoleName is discovered from the metadata service when empty
+	RoleName string
+	Disabled bool
+	Endpoint string
+	Client   *http.Client
+}
+
+func NewECSProviderFromEnv() *ECSProvider {
+	return &ECSProvider{
+		RoleName: os.Getenv(AlibabaCloudECSMetadataEnv),
+		Disabled: strings.EqualFold(os.Getenv(AlibabaCloudECSMetadataOffEnv), "true"),
+	}
+}
+
+func (p *ECSProvider) Name() string {
+	return CredentialSourceECS
+}
+
+func (p *ECSProvider) endpoint() string {
+	if len(p.Endpoint) == 0 {
+		return DefaultECSMetadataEndpoint
+	}
+	return strings.TrimSuffix(p.Endpoint, "/")
+}
+
+func (p *ECSProvider) Resolve() (auth.Credential, error) {
+	if p.Disabled {
+		return nil, NoCredentialsError
+	}
+	role := p.RoleName
+	if len(role) == 0 {
+		var err error
+		if role, err = p.probeRoleName(); err != nil {
+			return nil, NoCredentialsError
+		}
+	}
+	return NewSessionCredential(func() (*Session, error) {
+		req, err := http.NewRequest(http.MethodGet, p.endpoint()+ecsRoleCredentialsPath+role, nil)
+		if err != nil {
+			return nil, err
+		}
+		return fetchSession(p.Client, req)
+	}), nil
+}
+
+func (p *ECSProvider) probeRoleName() (string, error) {
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: ecsProbeTimeout}
+	}
+	resp, err := client.Get(p.endpoint() + ecsRoleCredentialsPath)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	role := strings.TrimSpace(string(data))
+	if resp.StatusCode != http.StatusOK || len(role) == 0 {
+		return "", fmt.Errorf("no ram role attached to the instance")
+	}
+	return role, nil
+}
+
+// URIProvider fetches credentials from a local HTTP endpoint, e.g. a sidecar serving the instance identity.
+type URIProvider struct {
+	URI    string
+	Client *http.Client
+}
+
+func NewURIProviderFromEnv() *URIProvider {
+	return &URIProvider{URI: os.Getenv(AlibabaCloudCredentialsURIEnv)}
+}
+
+func (p *URIProvider) Name() string {
+	return CredentialSourceURI
+}
+
+func (p *URIProvider) Resolve() (auth.Credential, error) {
+	if len(p.URI) == 0 {
+		return nil, NoCredentialsError
+	}
+	return NewSessionCredential(func() (*Session, error) {
+		req, err := http.NewRequest(http.MethodGet, p.URI, nil)
+		if err != nil {
+			return nil, err
+		}
+		return fetchSession(p.Client, req)
+	}), nil
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+)
+
+const sessionJSON = `{"AccessKeyId":"STS.id","AccessKeySecret":"secret","SecurityToken":"token","Expiration":"2099-01-01T00:00:00Z"}`
+
+func getSession(t *testing.T, cred auth.Credential) *Session {
+	t.Helper()
+	session, ok := cred.(*SessionCredential)
+	if !ok {
+		t.Fatalf("expected a session credential, got %T", cred)
+	}
+	s, err := session.Get()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return s
+}
+
+func checkSession(t *testing.T, s *Session) {
+	t.Helper()
+	if s.AccessKeyId != "STS.id" || s.AccessKeySecret != "secret" || s.SecurityToken != "token" {
+		t.Errorf("unexpected session: %+v", s)
+	}
+}
+
+func TestOIDCProvider(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("oidc-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if action := r.URL.Query().Get("Action"); action != "AssumeRoleWithOIDC" {
+			t.Errorf("unexpected action %q", action)
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		want := url.Values{
+			"RoleArn":         {"acs:ram::1:role/deployer"},
+			"OIDCProviderArn": {"acs:ram::1:oidc-provider/ack"},
+			"OIDCToken":       {"oidc-token"},
+			"RoleSessionName": {"ci"},
+		}
+		for key, value := range want {
+			if r.PostForm.Get(key) != value[0] {
+				t.Errorf("expected %s=%q, got %q", key, value[0], r.PostForm.Get(key))
+			}
+		}
+		fmt.Fprintf(w, `{"RequestId":"1","Credentials":%s}`, sessionJSON)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		provider *OIDCProvider
+		wantErr  error
+	}{
+		{
+			name:     "not configured",
+			provider: &OIDCProvider{STSEndpoint: server.URL},
+			wantErr:  NoCredentialsError,
+		},
+		{
+			name: "token exchanged",
+			provider: &OIDCProvider{
+				RoleArn:         "acs:ram::1:role/deployer",
+				OIDCProviderArn: "acs:ram::1:oidc-provider/ack",
+				TokenFile:       tokenFile,
+				SessionName:     "ci",
+				STSEndpoint:     server.URL,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := tt.provider.Resolve()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkSession(t, getSession(t, cred))
+		})
+	}
+}
+
+func TestECSProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case ecsRoleCredentialsPath:
+			fmt.Fprint(w, "sae-role")
+		case ecsRoleCredentialsPath + "sae-role":
+			fmt.Fprint(w, strings.Replace(sessionJSON, "{", `{"Code":"Success",`, 1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	noRole := httptest.NewServer(http.NotFoundHandler())
+	defer noRole.Close()
+
+	tests := []struct {
+		name     string
+		provider *ECSProvider
+		wantErr  error
+	}{
+		{name: "disabled", provider: &ECSProvider{Disabled: true, Endpoint: server.URL}, wantErr: NoCredentialsError},
+		{name: "no role attached", provider: &ECSProvider{Endpoint: noRole.URL}, wantErr: NoCredentialsError},
+		{name: "role discovered", provider: &ECSProvider{Endpoint: server.URL}},
+		{name: "role given", provider: &ECSProvider{RoleName: "sae-role", Endpoint: server.URL + "/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cred, err := tt.provider.Resolve()
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkSession(t, getSession(t, cred))
+		})
+	}
+}
+
+func TestURIProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, `{"Code":"Forbidden","Message":"denied"}`, http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, sessionJSON)
+	}))
+	defer server.Close()
+
+	if _, err := (&URIProvider{}).Resolve(); !errors.Is(err, NoCredentialsError) {
+		t.Errorf("expected %v without URI, got %v", NoCredentialsError, err)
+	}
+	cred, err := (&URIProvider{URI: server.URL + "/credentials"}).Resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkSession(t, getSession(t, cred))
+
+	cred, err = (&URIProvider{URI: server.URL + "/broken"}).Resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := cred.(*SessionCredential).Get(); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("expected the status in the error, got %v", err)
+	}
+}
+
+func TestSessionClientSignsWithOneSession(t *testing.T) {
+	var lock sync.Mutex
+	var received []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		received = append(received, r.URL.Query())
+		lock.Unlock()
+		fmt.Fprint(w, `{"RequestId":"1"}`)
+	}))
+	defer server.Close()
+
+	// every session is about to expire, so every Get fetches a new one
+	fetches := 0
+	credential := NewSessionCredential(func() (*Session, error) {
+		fetches++
+		return &Session{
+			AccessKeyId:     fmt.Sprintf("STS.%d", fetches),
+			AccessKeySecret: fmt.Sprintf("secret-%d", fetches),
+			SecurityToken:   fmt.Sprintf("token-%d", fetches),
+			Expiration:      time.Now().Add(time.Minute),
+		}, nil
+	})
+	cli, err := newSDKClient("cn-hangzhou", credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processor := withSession(cli, credential)
+	for i := 0; i < 3; i++ {
+		if _, err := processor.ProcessCommonRequest(newTestRequest(server.URL)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if fetches != 3 {
+		t.Errorf("expected one session per request, fetched %d for 3 requests", fetches)
+	}
+	for i, query := range received {
+		id, token := query.Get("AccessKeyId"), query.Get("SecurityToken")
+		if strings.TrimPrefix(id, "STS.") != strings.TrimPrefix(token, "token-") {
+			t.Errorf("request %d is signed by %s with the token of another session: %s", i, id, token)
+		}
+	}
+}
+
+func TestSessionClientReturnsFetchError(t *testing.T) {
+	fetchErr := errors.New("metadata service unreachable")
+	credential := NewSessionCredential(func() (*Session, error) {
+		return nil, fetchErr
+	})
+	cli, err := newSDKClient("cn-hangzhou", credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = withSession(cli, credential).ProcessCommonRequest(newTestRequest("http://127.0.0.1:1"))
+	if !errors.Is(err, fetchErr) {
+		t.Errorf("expected the fetch error, got %v", err)
+	}
+}
+
+func newTestRequest(endpoint string) *requests.CommonRequest {
+	u, _ := url.Parse(endpoint)
+	req := requests.NewCommonRequest()
+	req.Scheme = u.Scheme
+	req.Domain = u.Host
+	req.Version = "2015-04-01"
+	req.ApiName = "GetCallerIdentity"
+	return req
+}
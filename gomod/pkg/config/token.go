@@ -0,0 +1,45 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalGatewayAddress is where local clients holding the local token are sent by default,
+// the gateway listening there accepts the token instead of SAE.
+const LocalGatewayAddress = "127.0.0.1:8001"
+
+// LocalTokenFile is the token shared by the credential-process plugin and local clients of saectl
+// for one identity, see ClientConfig.LocalTokenScope. Only processes of the same user can read it.
+func LocalTokenFile(cacheDir, scope string) string {
+	sum := sha256.Sum256([]byte(scope))
+	return filepath.Join(cacheDir, "tokens", hex.EncodeToString(sum[:16]))
+}
+
+// LocalToken returns the local token of scope, generating it on first use.
+func LocalToken(cacheDir, scope string) (string, error) {
+	filename := LocalTokenFile(cacheDir, scope)
+	data, err := os.ReadFile(filename)
+	if err == nil && len(strings.TrimSpace(string(data))) != 0 {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(filename, []byte(token), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
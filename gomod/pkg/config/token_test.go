@@ -0,0 +1,67 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/auth/credentials"
+)
+
+func TestLocalTokenScope(t *testing.T) {
+	prod := &ClientConfig{ClientConfigOption: ClientConfigOption{
+		CurrentContext:   "prod",
+		Region:           "cn-hangzhou",
+		CredentialSource: "config",
+		Credential:       credentials.NewAccessKeyCredential("prod-id", "secret"),
+	}}
+	tests := []struct {
+		name      string
+		config    *ClientConfig
+		wantEqual bool
+	}{
+		{name: "same context and identity", config: prod, wantEqual: true},
+		{
+			name: "other context",
+			config: &ClientConfig{ClientConfigOption: ClientConfigOption{
+				CurrentContext:   "dev",
+				Region:           "cn-hangzhou",
+				CredentialSource: "config",
+				Credential:       credentials.NewAccessKeyCredential("prod-id", "secret"),
+			}},
+		},
+		{
+			name: "other access key",
+			config: &ClientConfig{ClientConfigOption: ClientConfigOption{
+				CurrentContext:   "prod",
+				Region:           "cn-hangzhou",
+				CredentialSource: "config",
+				Credential:       credentials.NewAccessKeyCredential("dev-id", "secret"),
+			}},
+		},
+		{
+			name: "assumed role",
+			config: &ClientConfig{ClientConfigOption: ClientConfigOption{
+				CurrentContext:   "prod",
+				Region:           "cn-hangzhou",
+				CredentialSource: "config",
+				RoleArn:          "acs:ram::123:role/admin",
+				Credential:       credentials.NewAccessKeyCredential("prod-id", "secret"),
+			}},
+		},
+	}
+	cacheDir := t.TempDir()
+	want, err := LocalToken(cacheDir, prod.LocalTokenScope())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := LocalToken(cacheDir, tt.config.LocalTokenScope())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (token == want) != tt.wantEqual {
+				t.Errorf("expected equal tokens %v, got %s and %s", tt.wantEqual, want, token)
+			}
+		})
+	}
+}
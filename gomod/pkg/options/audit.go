@@ -0,0 +1,136 @@
+package options
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/client-go/util/homedir"
+
+	"saectl/pkg/proxy"
+)
+
+const (
+	// AuditLogEnv overrides the default location of the audit log
+	AuditLogEnv = "SAEAUDITLOG"
+
+	redacted = "REDACTED"
+)
+
+// secretFlagWords mark flags whose values are secrets, e.g. --access-key-secret and --sts-token
+var secretFlagWords = []string{"secret", "token", "password"}
+
+// literalFlags hold key=value pairs whose values may be secrets, e.g. of `create secret generic`
+var literalFlags = map[string]bool{"from-literal": true}
+
+// InitAudit starts recording mutating requests to the audit sinks enabled by flags,
+// it must be called before the first client is created.
+func (f *Config) InitAudit(command, session string, arguments []string) error {
+	var sinks []proxy.AuditSink
+	if f.AuditLog != nil && len(*f.AuditLog) != 0 {
+		sinks = append(sinks, proxy.NewFileAuditSink(*f.AuditLog))
+	}
+	if f.AuditSyslog != nil && *f.AuditSyslog {
+		sink, err := proxy.NewSyslogAuditSink()
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil
+	}
+	if len(arguments) != 0 {
+		arguments = arguments[1:]
+	}
+	host, _ := os.Hostname()
+	f.auditor = proxy.NewAuditor(proxy.AuditRecord{
+		Command: command,
+		Args:    RedactArgs(arguments),
+		Session: session,
+		User:    currentUser(),
+		Host:    host,
+	}, sinks...)
+	return nil
+}
+
+// ToAuditLog returns the audit log selected by flags, empty if it is disabled.
+func (f *Config) ToAuditLog() string {
+	if f.AuditLog == nil {
+		return ""
+	}
+	return *f.AuditLog
+}
+
+// RedactArgs replaces the values of secret flags in a command line.
+func RedactArgs(args []string) []string {
+	redactedArgs := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		redactedArgs = append(redactedArgs, arg)
+		if arg == "--" {
+			redactedArgs = append(redactedArgs, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !isSecretFlag(name) {
+			continue
+		}
+		// the value is the next argument unless given with =
+		if !hasValue {
+			if i+1 == len(args) {
+				break
+			}
+			i++
+			value = args[i]
+		}
+		value = redactValue(name, value)
+		if hasValue {
+			redactedArgs[len(redactedArgs)-1] = "--" + name + "=" + value
+		} else {
+			redactedArgs = append(redactedArgs, value)
+		}
+	}
+	return redactedArgs
+}
+
+func isSecretFlag(name string) bool {
+	if literalFlags[name] {
+		return true
+	}
+	for _, word := range secretFlagWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactValue keeps the key of a literal, so the record still tells which key was set.
+func redactValue(name, value string) string {
+	if key, _, ok := strings.Cut(value, "="); ok && literalFlags[name] {
+		return key + "=" + redacted
+	}
+	return redacted
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+func getDefaultAuditLog() string {
+	if file := os.Getenv(AuditLogEnv); file != "" {
+		return file
+	}
+	return filepath.Join(homedir.HomeDir(), ".sae", "audit.log")
+}
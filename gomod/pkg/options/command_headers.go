@@ -0,0 +1,59 @@
+package options
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/spf13/cobra"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/uuid"
+
+	"saectl/pkg/proxy"
+)
+
+const (
+	// CommandHeader carries the invoked command, e.g. saectl create secret generic
+	CommandHeader = proxy.CommandHeader
+	// SessionHeader carries an id shared by all requests of one invocation
+	SessionHeader = proxy.SessionHeader
+)
+
+// CommandHeaderRoundTripper adds the command headers to every request, like kubectl does with Kubectl-Command and Kubectl-Session.
+type CommandHeaderRoundTripper struct {
+	Delegate http.RoundTripper
+	Headers  map[string]string
+}
+
+var _ utilnet.RoundTripperWrapper = &CommandHeaderRoundTripper{}
+
+func (c *CommandHeaderRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(c.Headers) != 0 {
+		req = utilnet.CloneRequest(req)
+		for header, value := range c.Headers {
+			req.Header.Set(header, value)
+		}
+	}
+	return c.Delegate.RoundTrip(req)
+}
+
+// CancelRequest is a no-op, requests are cancelled through their context.
+func (c *CommandHeaderRoundTripper) CancelRequest(req *http.Request) {}
+
+func (c *CommandHeaderRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return c.Delegate
+}
+
+// ParseCommandHeaders derives the headers from the invoked command, args are left out as they may hold secrets.
+func (c *CommandHeaderRoundTripper) ParseCommandHeaders(cmd *cobra.Command, args []string) {
+	if cmd == nil {
+		return
+	}
+	c.Headers = map[string]string{
+		SessionHeader: string(uuid.NewUUID()),
+	}
+	var names []string
+	for ; cmd != nil; cmd = cmd.Parent() {
+		names = append([]string{strings.TrimSpace(cmd.Name())}, names...)
+	}
+	c.Headers[CommandHeader] = strings.Join(names, " ")
+}
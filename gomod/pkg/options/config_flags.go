@@ -1,11 +1,15 @@
 package options
 
 import (
+	"fmt"
+	"io"
+
 	"github.com/spf13/pflag"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/discovery"
 	diskcached "k8s.io/client-go/discovery/cached/disk"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
@@ -15,21 +19,55 @@ import (
 	"path/filepath"
 	"regexp"
 	"saectl/pkg/config"
+	"saectl/pkg/proxy"
 	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	flagNamespace = "namespace"
-	flagAPIServer = "server"
+	flagNamespace  = "namespace"
+	flagAPIServer  = "server"
+	flagContext    = "context"
+	flagConfigFile = "saeconfig"
+	flagProfile    = "profile"
+	flagCredSource = "credential-source"
+	flagRoleArn    = "role-arn"
+	flagRoleSess   = "role-session-name"
+	flagRoleDur    = "role-duration"
+	flagRecord     = "record"
+	flagReplay     = "replay"
+	flagReplayMode = "replay-match"
+	flagRetries    = "max-retries"
+	flagRetryWait  = "retry-backoff"
+	flagRetryMax   = "retry-max-backoff"
+	flagRetryAll   = "retry-non-idempotent"
+	flagTimeout    = "request-timeout"
+	flagTrace      = "trace"
+	flagTraceFmt   = "trace-format"
+	flagUASuffix   = "user-agent-suffix"
+	flagQPS        = "qps"
+	flagBurst      = "burst"
+	flagNoCompress = "disable-compression"
+	flagAuditLog   = "audit-log"
+	flagAuditSys   = "audit-syslog"
+
+	// UserAgentSuffixEnv tags the requests of CI systems, where adding a flag to every call is cumbersome
+	UserAgentSuffixEnv = "SAECTL_USER_AGENT_SUFFIX"
 
-	AliCloudAccessKey = "ALICLOUD_ACCESS_KEY"
-	AliCloudSecretKey = "ALICLOUD_SECRET_KEY"
-	AliCloudStsToken  = "ALICLOUD_STS_TOKEN"
-	AliCloudRegion    = "ALICLOUD_REGION"
+	// traceToStderr is the file of a bare --trace
+	traceToStderr = "-"
+
+	AliCloudAccessKey = config.AliCloudAccessKeyEnv
+	AliCloudSecretKey = config.AliCloudSecretKeyEnv
+	AliCloudStsToken  = config.AliCloudStsTokenEnv
+	AliCloudRegion    = config.AliCloudRegionEnv
 )
 
+// AccountKey is the access key pair of flags and env.
+//
+// Deprecated: the access key pair is one of the sources of the credential chain, use ToClientConfig
+// and the Credential of the resolved config instead.
 type AccountKey struct {
 	AccessKey    string
 	AccessSecret string
@@ -38,7 +76,8 @@ type AccountKey struct {
 }
 
 type Config struct {
-	CacheDir *string
+	CacheDir   *string
+	ConfigFile *string
 	// config flags
 	ClusterName     *string
 	AuthInfoName    *string
@@ -49,12 +88,50 @@ type Config struct {
 	AccessSecretKey *string
 	StsToken        *string
 	Region          *string
+	Profile         *string
+	// CredentialSource forces a single source of the credential chain
+	CredentialSource *string
+	// RoleArn is assumed with the resolved credentials, sessions are cached under CacheDir
+	RoleArn         *string
+	RoleSessionName *string
+	RoleDuration    *time.Duration
+	// Record and Replay name a cassette of the POP requests, ReplayMatch is strict or lenient
+	Record      *string
+	Replay      *string
+	ReplayMatch *string
+	// Retry flags, see proxy.RetryPolicy
+	MaxRetries         *int
+	RetryBackoff       *time.Duration
+	RetryMaxBackoff    *time.Duration
+	RetryNonIdempotent *bool
+	// Timeout is kept as string to accept plain seconds like kubectl does
+	Timeout *string
+	// Trace names the file of the request timeline, - for stderr
+	Trace       *string
+	TraceFormat *string
+	// UserAgentSuffix is appended to the User-Agent of every request, defaults to $SAECTL_USER_AGENT_SUFFIX
+	UserAgentSuffix *string
+	// QPS and Burst limit all requests together, zero takes the value of the context
+	QPS   *float32
+	Burst *int
+	// DisableCompression sends and accepts plain envelope contents only
+	DisableCompression *bool
+	// AuditLog names the JSON lines file mutating requests are recorded to, empty disables it
+	AuditLog    *string
+	AuditSyslog *bool
 
 	// If non-nil, wrap config function can transform the Config
 	// before it is returned in ToRESTConfig function.
 	WrapConfigFn func(*rest.Config) *rest.Config
 
 	rwLock sync.RWMutex
+	// clientConfigBuilder is created once so credentials are resolved once per invocation
+	clientConfigBuilder *config.ClientConfigBuilder
+	// tracer is started by InitTrace, traceFile is closed by FlushTrace
+	tracer    *proxy.Tracer
+	traceFile io.Closer
+	// auditor is started by InitAudit
+	auditor *proxy.Auditor
 
 	// Allows increasing burst used for discovery, this is useful
 	// in clusters with many registered resources
@@ -68,18 +145,40 @@ var _ genericclioptions.RESTClientGetter = &Config{}
 
 func NewConfig() *Config {
 	return &Config{
-		CacheDir:        utilpointer.String(getDefaultCacheDir()),
-		ClusterName:     utilpointer.String(""),
-		AuthInfoName:    utilpointer.String(""),
-		Context:         utilpointer.String(""),
-		Namespace:       utilpointer.String(""),
-		APIServer:       utilpointer.String(""),
-		AccessKey:       utilpointer.String(""),
-		AccessSecretKey: utilpointer.String(""),
-		StsToken:        utilpointer.String(""),
-		Region:          utilpointer.String(""),
-		discoveryBurst:  300,
-		rwLock:          sync.RWMutex{},
+		CacheDir:           utilpointer.String(getDefaultCacheDir()),
+		ConfigFile:         utilpointer.String(""),
+		ClusterName:        utilpointer.String(""),
+		AuthInfoName:       utilpointer.String(""),
+		Context:            utilpointer.String(""),
+		Namespace:          utilpointer.String(""),
+		APIServer:          utilpointer.String(""),
+		AccessKey:          utilpointer.String(""),
+		AccessSecretKey:    utilpointer.String(""),
+		StsToken:           utilpointer.String(""),
+		Region:             utilpointer.String(""),
+		Profile:            utilpointer.String(""),
+		CredentialSource:   utilpointer.String(""),
+		RoleArn:            utilpointer.String(""),
+		RoleSessionName:    utilpointer.String(""),
+		RoleDuration:       utilpointer.Duration(config.DefaultRoleDuration),
+		Record:             utilpointer.String(""),
+		Replay:             utilpointer.String(""),
+		ReplayMatch:        utilpointer.String(string(proxy.MatchStrict)),
+		MaxRetries:         utilpointer.Int(proxy.DefaultMaxRetries),
+		RetryBackoff:       utilpointer.Duration(proxy.DefaultRetryBackoff),
+		RetryMaxBackoff:    utilpointer.Duration(proxy.DefaultRetryMaxBackoff),
+		RetryNonIdempotent: utilpointer.Bool(false),
+		Timeout:            utilpointer.String("0"),
+		Trace:              utilpointer.String(""),
+		TraceFormat:        utilpointer.String(string(proxy.TraceText)),
+		UserAgentSuffix:    utilpointer.String(""),
+		QPS:                utilpointer.Float32(0),
+		Burst:              utilpointer.Int(0),
+		DisableCompression: utilpointer.Bool(false),
+		AuditLog:           utilpointer.String(getDefaultAuditLog()),
+		AuditSyslog:        utilpointer.Bool(false),
+		discoveryBurst:     300,
+		rwLock:             sync.RWMutex{},
 	}
 }
 
@@ -102,6 +201,76 @@ func (f *Config) AddFlags(flags *pflag.FlagSet) {
 	if f.Namespace != nil {
 		flags.StringVarP(f.Namespace, flagNamespace, "n", *f.Namespace, "If present, the namespace scope for this CLI request")
 	}
+	if f.Context != nil {
+		flags.StringVar(f.Context, flagContext, *f.Context, "The name of the saectl config context to use")
+	}
+	if f.ConfigFile != nil {
+		flags.StringVar(f.ConfigFile, flagConfigFile, *f.ConfigFile, "Path to the saectl config file, defaults to $SAECONFIG or ~/.sae/config")
+	}
+	if f.Profile != nil {
+		flags.StringVar(f.Profile, flagProfile, *f.Profile, "The aliyun cli profile in ~/.aliyun/config.json to take credentials from, defaults to $ALIBABA_CLOUD_PROFILE")
+	}
+	if f.CredentialSource != nil {
+		flags.StringVar(f.CredentialSource, flagCredSource, *f.CredentialSource, "Only take credentials from this source instead of the whole chain. One of: flags|env|profile|config|oidc|ecs|uri")
+	}
+	if f.RoleArn != nil {
+		flags.StringVar(f.RoleArn, flagRoleArn, *f.RoleArn, "The RAM role to assume with the resolved credentials, e.g. acs:ram::<account-id>:role/<role-name>")
+	}
+	if f.RoleSessionName != nil {
+		flags.StringVar(f.RoleSessionName, flagRoleSess, *f.RoleSessionName, "The session name of the assumed RAM role, defaults to saectl")
+	}
+	if f.RoleDuration != nil {
+		flags.DurationVar(f.RoleDuration, flagRoleDur, *f.RoleDuration, "The lifetime of the assumed RAM role session, between 15m and 12h")
+	}
+	if f.Record != nil {
+		flags.StringVar(f.Record, flagRecord, *f.Record, "Record the requests to SAE and their responses to this cassette file, credentials and signatures are scrubbed")
+	}
+	if f.Replay != nil {
+		flags.StringVar(f.Replay, flagReplay, *f.Replay, "Answer the requests to SAE from this cassette file instead of the network")
+	}
+	if f.ReplayMatch != nil {
+		flags.StringVar(f.ReplayMatch, flagReplayMode, *f.ReplayMatch, "How requests are matched against the cassette of --replay. One of: strict|lenient")
+	}
+	if f.MaxRetries != nil {
+		flags.IntVar(f.MaxRetries, flagRetries, *f.MaxRetries, "Retries of a request to SAE that was throttled or failed transiently, 0 disables retrying")
+	}
+	if f.RetryBackoff != nil {
+		flags.DurationVar(f.RetryBackoff, flagRetryWait, *f.RetryBackoff, "The delay before the first retry, doubled with every retry unless the response asks for a longer one with Retry-After")
+	}
+	if f.RetryMaxBackoff != nil {
+		flags.DurationVar(f.RetryMaxBackoff, flagRetryMax, *f.RetryMaxBackoff, "The longest delay between two retries")
+	}
+	if f.RetryNonIdempotent != nil {
+		flags.BoolVar(f.RetryNonIdempotent, flagRetryAll, *f.RetryNonIdempotent, "Also retry POST and PATCH requests after transient failures, which may then be applied twice. Throttled requests are always retried")
+	}
+	if f.Timeout != nil {
+		flags.StringVar(f.Timeout, flagTimeout, *f.Timeout, "The length of time to wait before giving up on a single server request. Non-zero values should contain a corresponding time unit (e.g. 1s, 2m, 3h). A value of zero means don't timeout requests.")
+	}
+	if f.Trace != nil {
+		flags.StringVar(f.Trace, flagTrace, *f.Trace, "Write a timeline of the requests to SAE and a summary to this file, or to stderr if no file is given")
+		flags.Lookup(flagTrace).NoOptDefVal = traceToStderr
+	}
+	if f.TraceFormat != nil {
+		flags.StringVar(f.TraceFormat, flagTraceFmt, *f.TraceFormat, "The format of --trace. One of: text|json")
+	}
+	if f.UserAgentSuffix != nil {
+		flags.StringVar(f.UserAgentSuffix, flagUASuffix, *f.UserAgentSuffix, "A tag appended to the User-Agent of requests to identify the caller, e.g. a CI pipeline, defaults to $"+UserAgentSuffixEnv)
+	}
+	if f.QPS != nil {
+		flags.Float32Var(f.QPS, flagQPS, *f.QPS, fmt.Sprintf("The maximum queries per second of all requests to SAE, defaults to the qps of the context or %v. A negative value disables the limit", proxy.DefaultQPS))
+	}
+	if f.Burst != nil {
+		flags.IntVar(f.Burst, flagBurst, *f.Burst, fmt.Sprintf("The maximum burst of requests to SAE above --qps, defaults to the burst of the context or %d", proxy.DefaultBurst))
+	}
+	if f.DisableCompression != nil {
+		flags.BoolVar(f.DisableCompression, flagNoCompress, *f.DisableCompression, "If true, request and response contents are sent to SAE uncompressed")
+	}
+	if f.AuditLog != nil {
+		flags.StringVar(f.AuditLog, flagAuditLog, *f.AuditLog, "The file every mutating request to SAE is recorded to as JSON lines, defaults to $"+AuditLogEnv+". An empty value disables it")
+	}
+	if f.AuditSyslog != nil {
+		flags.BoolVar(f.AuditSyslog, flagAuditSys, *f.AuditSyslog, "If true, mutating requests to SAE are recorded to the local syslog as well")
+	}
 }
 
 func (f *Config) WithDiscoveryBurst(burst int) *Config {
@@ -115,7 +284,7 @@ func (f *Config) WithDiscoveryQPS(qps float32) *Config {
 }
 
 func (f *Config) ToRESTConfig() (*rest.Config, error) {
-	clientConfig, err := f.toRawKubeConfigLoader().Build()
+	clientConfig, err := f.ToClientConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -137,12 +306,16 @@ func (f *Config) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error)
 	config.Burst = f.discoveryBurst
 	config.QPS = f.discoveryQPS
 
-	cacheDir := getDefaultCacheDir()
-
-	if f.CacheDir != nil && *f.CacheDir != "" && *f.CacheDir != getDefaultCacheDir() {
-		cacheDir = *f.CacheDir
+	// a cassette holds all requests of an invocation, the disk cache would make them depend on earlier runs
+	if *f.Record != "" || *f.Replay != "" {
+		discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		return memory.NewMemCacheClient(discoveryClient), nil
 	}
 
+	cacheDir := f.getCacheDir()
 	httpCacheDir := filepath.Join(cacheDir, "http")
 	discoveryCacheDir := computeDiscoverCacheDir(filepath.Join(cacheDir, "discovery"), config.Host)
 	return diskcached.NewCachedDiscoveryClientForConfig(config, discoveryCacheDir, httpCacheDir, time.Duration(6*time.Hour))
@@ -164,16 +337,131 @@ func (f *Config) ToRawKubeConfigLoader() clientcmd.ClientConfig {
 }
 
 func (f *Config) toRawKubeConfigLoader() *config.ClientConfigBuilder {
-	accountKey := f.GetAccountKey()
+	f.rwLock.Lock()
+	defer f.rwLock.Unlock()
+	if f.clientConfigBuilder == nil {
+		f.clientConfigBuilder = f.newClientConfigBuilder()
+	}
+	return f.clientConfigBuilder
+}
+
+// newClientConfigBuilder passes the credential flags as is, env and files are consulted by the credential chain.
+func (f *Config) newClientConfigBuilder() *config.ClientConfigBuilder {
+	region := *f.Region
+	if region == "" {
+		region = os.Getenv(AliCloudRegion)
+	}
 	return config.NewClientConfigBuilder().
-		WithRegion(accountKey.Region).
-		WithAccessKeyId(accountKey.AccessKey).
-		WithAccessKeySecret(accountKey.AccessSecret).
-		WithStsToken(accountKey.StsToken).
+		WithRegion(region).
+		WithAccessKeyId(*f.AccessKey).
+		WithAccessKeySecret(*f.AccessSecretKey).
+		WithStsToken(*f.StsToken).
+		WithCredentialSource(*f.CredentialSource).
+		WithAssumeRole(*f.RoleArn, *f.RoleSessionName, *f.RoleDuration).
+		WithCacheDir(f.getCacheDir()).
 		WithClusterServer(*f.APIServer).
-		WithNamespace(*f.Namespace)
+		WithNamespace(*f.Namespace).
+		WithContext(*f.Context).
+		WithConfigFile(*f.ConfigFile).
+		WithAliyunProfile(f.getProfile()).
+		WithRecord(*f.Record).
+		WithReplay(*f.Replay, proxy.MatchMode(*f.ReplayMatch)).
+		WithRetryPolicy(f.retryPolicy()).
+		WithRequestTimeout(*f.Timeout).
+		WithTracer(f.tracer).
+		WithRateLimit(*f.QPS, *f.Burst).
+		WithDisableCompression(*f.DisableCompression).
+		WithAuditor(f.auditor)
+}
+
+// InitTrace starts tracing requests if --trace is set, it must be called before the first client is created.
+func (f *Config) InitTrace() error {
+	if f.Trace == nil || len(*f.Trace) == 0 {
+		return nil
+	}
+	var out io.Writer = os.Stderr
+	if *f.Trace != traceToStderr {
+		file, err := os.OpenFile(*f.Trace, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("fail to create trace file: %v", err)
+		}
+		out, f.traceFile = file, file
+	}
+	tracer, err := proxy.NewTracer(out, proxy.TraceFormat(*f.TraceFormat))
+	if err != nil {
+		return err
+	}
+	f.tracer = tracer
+	return nil
+}
+
+// FlushTrace writes the summary of the traced requests, it may be called more than once.
+func (f *Config) FlushTrace() error {
+	if f.tracer == nil {
+		return nil
+	}
+	err := f.tracer.Flush()
+	f.tracer = nil
+	if f.traceFile != nil {
+		if closeErr := f.traceFile.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func (f *Config) retryPolicy() *proxy.RetryPolicy {
+	policy := proxy.NewDefaultRetryPolicy()
+	policy.MaxRetries = *f.MaxRetries
+	policy.Backoff = *f.RetryBackoff
+	policy.MaxBackoff = *f.RetryMaxBackoff
+	policy.NonIdempotent = *f.RetryNonIdempotent
+	return policy
+}
+
+// GetUserAgentSuffix returns the caller tag of --user-agent-suffix or its env.
+func (f *Config) GetUserAgentSuffix() string {
+	if f.UserAgentSuffix != nil && *f.UserAgentSuffix != "" {
+		return *f.UserAgentSuffix
+	}
+	return os.Getenv(UserAgentSuffixEnv)
 }
 
+func (f *Config) getProfile() string {
+	if profile := *f.Profile; profile != "" {
+		return profile
+	}
+	return os.Getenv(config.AliyunProfileEnv)
+}
+
+// ToClientConfig resolves flags, env and the config file into the effective client config.
+func (f *Config) ToClientConfig() (*config.ClientConfig, error) {
+	return f.toRawKubeConfigLoader().ToClientConfig()
+}
+
+// ToSessionCache returns the cache of assumed role sessions.
+func (f *Config) ToSessionCache() *config.SessionCache {
+	return config.NewSessionCache(f.getCacheDir())
+}
+
+// ToLocalToken returns the token authenticating local clients of the selected context and identity, see config.LocalToken.
+func (f *Config) ToLocalToken() (string, error) {
+	clientConfig, err := f.ToClientConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.LocalToken(f.getCacheDir(), clientConfig.LocalTokenScope())
+}
+
+// ToFileAccess returns the accessor of the saectl config file selected by flags.
+func (f *Config) ToFileAccess() *config.FileAccess {
+	return f.toRawKubeConfigLoader().FileAccess()
+}
+
+// GetAccountKey returns the access key pair of flags, falling back to env.
+//
+// Deprecated: it ignores the saectl config file, aliyun CLI profiles and assumed roles,
+// use ToClientConfig and the Credential of the resolved config instead.
 func (f *Config) GetAccountKey() AccountKey {
 	ak, sk, sts, region := *f.AccessKey, *f.AccessSecretKey, *f.StsToken, *f.Region
 	if ak == "" {
@@ -196,6 +484,13 @@ func (f *Config) GetAccountKey() AccountKey {
 	}
 }
 
+func (f *Config) getCacheDir() string {
+	if f.CacheDir != nil && *f.CacheDir != "" {
+		return *f.CacheDir
+	}
+	return getDefaultCacheDir()
+}
+
 func getDefaultCacheDir() string {
 	if kcd := os.Getenv("SAECACHEDIR"); kcd != "" {
 		return kcd
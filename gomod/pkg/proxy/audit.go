@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+)
+
+// AuditRecord describes a mutating request, one JSON object per line in the audit log.
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Command and Args are the invocation, with the values of secret flags redacted
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	Session string   `json:"session,omitempty"`
+	// User and Host name the workstation account that ran the command
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+
+	AuditAccount
+
+	Namespace   string `json:"namespace,omitempty"`
+	Resource    string `json:"resource,omitempty"`
+	Subresource string `json:"subresource,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Verb        string `json:"verb"`
+	Path        string `json:"path"`
+	DryRun      bool   `json:"dryRun,omitempty"`
+	Status      int    `json:"status,omitempty"`
+	Error       string `json:"error,omitempty"`
+	RequestId   string `json:"requestId,omitempty"`
+}
+
+// AuditAccount identifies the Alibaba Cloud account the requests are sent with.
+type AuditAccount struct {
+	CredentialSource string `json:"credentialSource,omitempty"`
+	AccessKeyId      string `json:"accessKeyId,omitempty"`
+	RoleArn          string `json:"roleArn,omitempty"`
+	Region           string `json:"region,omitempty"`
+}
+
+// AuditSink stores audit records, it must be safe for concurrent use.
+type AuditSink interface {
+	Write(record *AuditRecord) error
+}
+
+// Auditor records every mutating request to its sinks, reads are not recorded.
+type Auditor struct {
+	// Invocation is the template of the records, the request fills in the rest
+	Invocation AuditRecord
+	Sinks      []AuditSink
+}
+
+func NewAuditor(invocation AuditRecord, sinks ...AuditSink) *Auditor {
+	return &Auditor{Invocation: invocation, Sinks: sinks}
+}
+
+// WrapperFor returns a wrapper auditing the requests sent with account, it is meant to wrap a Transport.
+func (a *Auditor) WrapperFor(account AuditAccount) transport.WrapperFunc {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &auditingTransport{auditor: a, account: account, delegate: rt}
+	}
+}
+
+// record writes to all sinks, a failing sink is logged as the request has been sent already.
+func (a *Auditor) record(record *AuditRecord) {
+	for _, sink := range a.Sinks {
+		if err := sink.Write(record); err != nil {
+			klog.Warningf("fail to write audit record: %v", err)
+		}
+	}
+}
+
+type auditingTransport struct {
+	auditor  *Auditor
+	account  AuditAccount
+	delegate http.RoundTripper
+}
+
+func (t *auditingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isMutating(req.Method) {
+		return t.delegate.RoundTrip(req)
+	}
+	// the RequestId is learned through the trace, which a Tracer may have set up already
+	trace := RequestTraceFrom(req.Context())
+	if trace == nil {
+		trace = &RequestTrace{}
+		req = req.WithContext(WithRequestTrace(req.Context(), trace))
+	}
+	record := t.auditor.Invocation
+	record.AuditAccount = t.account
+	record.Time = time.Now()
+	record.Verb = req.Method
+	record.Path = req.URL.Path
+	record.Namespace, record.Resource, record.Name, record.Subresource = parseResourcePath(req.URL.Path)
+	record.DryRun = len(req.URL.Query()["dryRun"]) != 0
+	if len(record.Name) == 0 && req.Method == http.MethodPost {
+		record.Name = objectName(req)
+	}
+
+	response, err := t.delegate.RoundTrip(req)
+	record.RequestId = trace.RequestId
+	if err != nil {
+		record.Error = err.Error()
+	} else {
+		record.Status = response.StatusCode
+	}
+	t.auditor.record(&record)
+	return response, err
+}
+
+// CancelRequest is a no-op, requests are cancelled through their context.
+func (t *auditingTransport) CancelRequest(req *http.Request) {}
+
+func (t *auditingTransport) WrappedRoundTripper() http.RoundTripper {
+	return t.delegate
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// parseResourcePath splits a Kubernetes resource path like /apis/apps/v1/namespaces/demo/deployments/web/scale.
+func parseResourcePath(path string) (namespace, resource, name, subresource string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		parts = parts[3:]
+	default:
+		return "", "", "", ""
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		namespace, parts = parts[1], parts[2:]
+	}
+	if len(parts) == 0 || parts[0] == "" {
+		return namespace, "", "", ""
+	}
+	resource = parts[0]
+	if len(parts) >= 2 {
+		name = parts[1]
+	}
+	if len(parts) >= 3 {
+		subresource = parts[2]
+	}
+	return namespace, resource, name, subresource
+}
+
+// objectName returns the name of the object created by req, the name of a create is only part of its body.
+func objectName(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	var obj struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(body).Decode(&obj); err != nil {
+		return ""
+	}
+	return obj.Metadata.Name
+}
+
+// FileAuditSink appends records as JSON lines to a file, created with its directory on first use.
+// The file is opened for every record, so concurrent invocations append whole lines.
+type FileAuditSink struct {
+	Filename string
+
+	lock sync.Mutex
+}
+
+func NewFileAuditSink(filename string) *FileAuditSink {
+	return &FileAuditSink{Filename: filename}
+}
+
+func (s *FileAuditSink) Write(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.Filename), 0700); err != nil {
+		return fmt.Errorf("fail to create audit log directory: %v", err)
+	}
+	file, err := os.OpenFile(s.Filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("fail to open audit log: %v", err)
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("fail to write audit log: %v", err)
+	}
+	return file.Close()
+}
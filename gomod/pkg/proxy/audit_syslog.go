@@ -0,0 +1,30 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogAuditSink sends records as JSON to the local syslog daemon, tagged saectl.
+type SyslogAuditSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogAuditSink() (*SyslogAuditSink, error) {
+	writer, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_AUTH, "saectl")
+	if err != nil {
+		return nil, fmt.Errorf("fail to connect to syslog: %v", err)
+	}
+	return &SyslogAuditSink{writer: writer}, nil
+}
+
+func (s *SyslogAuditSink) Write(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.writer.Notice(string(data))
+}
@@ -0,0 +1,14 @@
+package proxy
+
+import "errors"
+
+// SyslogAuditSink is not available on windows, which has no syslog daemon.
+type SyslogAuditSink struct{}
+
+func NewSyslogAuditSink() (*SyslogAuditSink, error) {
+	return nil, errors.New("syslog is not supported on windows")
+}
+
+func (s *SyslogAuditSink) Write(record *AuditRecord) error {
+	return nil
+}
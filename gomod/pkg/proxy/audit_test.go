@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+)
+
+type failingSink struct{}
+
+func (failingSink) Write(record *AuditRecord) error {
+	return errors.New("disk full")
+}
+
+// readAuditLog returns the records of an audit log file, none if it was never written.
+func readAuditLog(t *testing.T, filename string) []*AuditRecord {
+	t.Helper()
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []*AuditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := new(AuditRecord)
+		if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditor(t *testing.T) {
+	created := envelope(t, Output{RequestId: "created", Code: http.StatusCreated}, `{"kind":"ConfigMap"}`)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		attempts []attempt
+		// want is nil for a request that is not recorded
+		want *AuditRecord
+	}{
+		{name: "read", method: http.MethodGet, path: "/api/v1/namespaces/demo/configmaps/web", attempts: []attempt{succeeded}},
+		{
+			name:     "create",
+			method:   http.MethodPost,
+			path:     "/api/v1/namespaces/demo/configmaps",
+			body:     `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"web"}}`,
+			attempts: []attempt{created},
+			want: &AuditRecord{Verb: http.MethodPost, Path: "/api/v1/namespaces/demo/configmaps",
+				Namespace: "demo", Resource: "configmaps", Name: "web", Status: http.StatusCreated, RequestId: "created"},
+		},
+		{
+			name:     "scale",
+			method:   http.MethodPatch,
+			path:     "/apis/apps/v1/namespaces/demo/deployments/web/scale",
+			body:     `{"spec":{"replicas":3}}`,
+			attempts: []attempt{succeeded},
+			want: &AuditRecord{Verb: http.MethodPatch, Path: "/apis/apps/v1/namespaces/demo/deployments/web/scale",
+				Namespace: "demo", Resource: "deployments", Name: "web", Subresource: "scale", Status: http.StatusOK, RequestId: "ok"},
+		},
+		{
+			name:     "dry run",
+			method:   http.MethodDelete,
+			path:     "/apis/apps/v1/namespaces/demo/deployments/web?dryRun=All",
+			attempts: []attempt{succeeded},
+			want: &AuditRecord{Verb: http.MethodDelete, Path: "/apis/apps/v1/namespaces/demo/deployments/web",
+				Namespace: "demo", Resource: "deployments", Name: "web", DryRun: true, Status: http.StatusOK, RequestId: "ok"},
+		},
+		{
+			name:     "denied",
+			method:   http.MethodPut,
+			path:     "/api/v1/namespaces/demo",
+			body:     `{"metadata":{"name":"demo"}}`,
+			attempts: []attempt{invalid},
+			want: &AuditRecord{Verb: http.MethodPut, Path: "/api/v1/namespaces/demo",
+				Resource: "namespaces", Name: "demo", Status: http.StatusBadRequest, RequestId: "invalid"},
+		},
+		{
+			name:     "failed",
+			method:   http.MethodDelete,
+			path:     "/api/v1/namespaces/demo/secrets/web",
+			attempts: []attempt{{err: sdkerrors.NewClientError("SDK.InvalidRegionId", "no region", nil)}},
+			want: &AuditRecord{Verb: http.MethodDelete, Path: "/api/v1/namespaces/demo/secrets/web",
+				Namespace: "demo", Resource: "secrets", Name: "web", Error: "SDK.InvalidRegionId"},
+		},
+	}
+	invocation := AuditRecord{Command: "saectl apply", Args: []string{"-f", "web.yaml", "--access-key-secret=REDACTED"}, Session: "session", User: "dev"}
+	account := AuditAccount{CredentialSource: "env", AccessKeyId: "LTAI-id", Region: "cn-hangzhou"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "audit", "audit.log")
+			auditor := NewAuditor(invocation, failingSink{}, NewFileAuditSink(filename))
+			rt := auditor.WrapperFor(account)(NewTransport(http.DefaultTransport, &scriptedProcessor{attempts: tt.attempts}))
+			req, err := http.NewRequest(tt.method, "https://sae.cn-hangzhou.aliyuncs.com"+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a failing sink must not fail the request, which was sent already
+			if response, err := rt.RoundTrip(req); err == nil {
+				response.Body.Close()
+			} else if tt.want == nil || len(tt.want.Error) == 0 {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			records := readAuditLog(t, filename)
+			if tt.want == nil {
+				if len(records) != 0 {
+					t.Errorf("expected no record, got %+v", records[0])
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(records))
+			}
+			got := records[0]
+			if got.Time.IsZero() {
+				t.Error("expected the time of the request")
+			}
+			if got.Command != invocation.Command || strings.Join(got.Args, " ") != strings.Join(invocation.Args, " ") ||
+				got.Session != invocation.Session || got.User != invocation.User || got.AuditAccount != account {
+				t.Errorf("expected the invocation %+v with account %+v, got %+v", invocation, account, got)
+			}
+			if !strings.Contains(got.Error, tt.want.Error) || (len(tt.want.Error) == 0) != (len(got.Error) == 0) {
+				t.Errorf("expected error %q, got %q", tt.want.Error, got.Error)
+			}
+			got.Time, got.Error = tt.want.Time, tt.want.Error
+			got.Command, got.Args, got.Session, got.User, got.AuditAccount = "", nil, "", "", AuditAccount{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestAuditorWithTracer learns the RequestId through a trace set up by a Tracer.
+func TestAuditorWithTracer(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "audit.log")
+	tracer, err := NewTracer(&strings.Builder{}, TraceJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	auditor := NewAuditor(AuditRecord{Command: "saectl delete"}, NewFileAuditSink(filename))
+	rt := tracer.WrapTransport(auditor.WrapperFor(AuditAccount{})(
+		NewTransport(http.DefaultTransport, &scriptedProcessor{attempts: []attempt{succeeded}})))
+	req, err := http.NewRequest(http.MethodDelete, "https://sae.cn-hangzhou.aliyuncs.com/api/v1/namespaces/demo/pods/web", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rt.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if records := readAuditLog(t, filename); len(records) != 1 || records[0].RequestId != "ok" {
+		t.Errorf("expected a record with RequestId ok, got %+v", records)
+	}
+}
+
+func TestParseResourcePath(t *testing.T) {
+	tests := []struct {
+		path                                   string
+		namespace, resource, name, subresource string
+	}{
+		{path: "/api/v1/namespaces/demo/pods", namespace: "demo", resource: "pods"},
+		{path: "/api/v1/namespaces/demo/pods/web/log", namespace: "demo", resource: "pods", name: "web", subresource: "log"},
+		{path: "/apis/apps/v1/namespaces/demo/deployments/web/scale", namespace: "demo", resource: "deployments", name: "web", subresource: "scale"},
+		{path: "/api/v1/namespaces", resource: "namespaces"},
+		{path: "/api/v1/namespaces/demo", resource: "namespaces", name: "demo"},
+		{path: "/apis/rbac.authorization.k8s.io/v1/clusterroles/view", resource: "clusterroles", name: "view"},
+		{path: "/api/v1"},
+		{path: "/apis/apps/v1/namespaces/demo/", resource: "namespaces", name: "demo"},
+		{path: "/version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			namespace, resource, name, subresource := parseResourcePath(tt.path)
+			if namespace != tt.namespace || resource != tt.resource || name != tt.name || subresource != tt.subresource {
+				t.Errorf("expected %q %q %q %q, got %q %q %q %q",
+					tt.namespace, tt.resource, tt.name, tt.subresource, namespace, resource, name, subresource)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"k8s.io/klog/v2"
+)
+
+// MatchMode decides which recorded interaction answers a request during replay.
+type MatchMode string
+
+const (
+	// MatchStrict answers each request with an unused interaction recorded for an equal request,
+	// order is ignored since clients like discovery send requests in parallel and the endpoint is
+	// ignored so that a cassette replays against another region or --server
+	MatchStrict MatchMode = "strict"
+	// MatchLenient only compares method and path, query and body are ignored and interactions may be reused
+	MatchLenient MatchMode = "lenient"
+
+	redacted = "REDACTED"
+)
+
+var NoInteractionError = errors.New("no recorded interaction matches the request")
+
+// scrubbedHeaders carry credentials or signatures, they are stored as REDACTED.
+var scrubbedHeaders = map[string]bool{
+	"authorization":        true,
+	"x-acs-security-token": true,
+	"x-acs-bearer-token":   true,
+	"x-acs-accesskey-id":   true,
+}
+
+// volatileHeaders change on every call and are dropped.
+var volatileHeaders = map[string]bool{
+	"date":                  true,
+	"x-acs-signature-nonce": true,
+}
+
+// scrubbedQueries and volatileQueries are their counterparts for RPC style requests, which are signed in the query.
+var scrubbedQueries = map[string]bool{
+	"AccessKeyId":   true,
+	"Signature":     true,
+	"SecurityToken": true,
+	"BearerToken":   true,
+}
+
+var volatileQueries = map[string]bool{
+	"SignatureNonce": true,
+	"Timestamp":      true,
+}
+
+// Interaction is an envelope request and its response as stored in a cassette, one per line.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Domain string            `json:"domain"`
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Query  map[string]string `json:"query,omitempty"`
+	Header map[string]string `json:"header,omitempty"`
+	Input  *Input            `json:"input,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status  int    `json:"status,omitempty"`
+	Content string `json:"content,omitempty"`
+	// Error is set when the request failed without response, e.g. on network errors
+	Error string `json:"error,omitempty"`
+}
+
+func (r *RecordedRequest) String() string {
+	if r.Input == nil {
+		return fmt.Sprintf("%s %s", r.Method, r.Path)
+	}
+	return fmt.Sprintf("%s %s", r.Input.Method, r.Input.Path)
+}
+
+func newRecordedRequest(request *requests.CommonRequest) *RecordedRequest {
+	recorded := &RecordedRequest{
+		Domain: request.Domain,
+		Method: request.Method,
+		Path:   request.PathPattern,
+		Query:  map[string]string{},
+		Header: map[string]string{},
+	}
+	for k, v := range request.GetQueryParams() {
+		switch {
+		case volatileQueries[k]:
+			continue
+		case scrubbedQueries[k]:
+			v = redacted
+		}
+		recorded.Query[k] = v
+	}
+	for k, v := range request.GetHeaders() {
+		switch key := strings.ToLower(k); {
+		case volatileHeaders[key]:
+			continue
+		case scrubbedHeaders[key]:
+			v = redacted
+		}
+		recorded.Header[k] = v
+	}
+	if content := request.GetContent(); len(content) != 0 {
+		in := new(Input)
+		if err := json.Unmarshal(content, in); err == nil {
+			if len(in.Header["Authorization"]) != 0 {
+				in.Header["Authorization"] = []string{redacted}
+			}
+			// cassettes keep the plain content, so they stay readable and match whether or not it was compressed
+			if data, err := in.DecodeContent(); err == nil {
+				in.SetContent(data)
+			}
+			recorded.Input = in
+		}
+	}
+	return recorded
+}
+
+// Recorder passes requests on to a processor and appends every interaction to a cassette file.
+type Recorder struct {
+	Processor
+
+	lock sync.Mutex
+	file *os.File
+}
+
+var _ Processor = &Recorder{}
+
+// NewRecorder truncates the cassette file, it is written as requests are made so an aborted command keeps its interactions.
+func NewRecorder(filename string, processor Processor) (*Recorder, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create cassette: %v", err)
+	}
+	return &Recorder{Processor: processor, file: file}, nil
+}
+
+func (r *Recorder) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	response, err := r.Processor.ProcessCommonRequest(request)
+	interaction := &Interaction{Request: *newRecordedRequest(request)}
+	if response != nil && response.GetHttpStatus() != 0 {
+		interaction.Response.Status = response.GetHttpStatus()
+		interaction.Response.Content = response.GetHttpContentString()
+	} else if err != nil {
+		interaction.Response.Error = err.Error()
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if encodeErr := json.NewEncoder(r.file).Encode(interaction); encodeErr != nil {
+		klog.Warningf("fail to record %s: %v", interaction.Request.String(), encodeErr)
+	}
+	return response, err
+}
+
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// Replayer answers requests from a cassette file and never touches the network.
+type Replayer struct {
+	match        MatchMode
+	interactions []*Interaction
+
+	lock sync.Mutex
+	used []bool
+}
+
+var _ Processor = &Replayer{}
+
+func NewReplayer(filename string, match MatchMode) (*Replayer, error) {
+	if match != MatchStrict && match != MatchLenient {
+		return nil, fmt.Errorf("unknown replay match %q, must be %s or %s", match, MatchStrict, MatchLenient)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open cassette: %v", err)
+	}
+	defer file.Close()
+	r := &Replayer{match: match}
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(data))) != 0 {
+			interaction := new(Interaction)
+			if err := json.Unmarshal(data, interaction); err != nil {
+				return nil, fmt.Errorf("fail to parse cassette %s line %d: %v", filename, line, err)
+			}
+			r.interactions = append(r.interactions, interaction)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.used = make([]bool, len(r.interactions))
+	return r, nil
+}
+
+func (r *Replayer) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	request.TransToAcsRequest()
+	recorded := newRecordedRequest(request)
+	interaction, err := r.find(recorded)
+	if err != nil {
+		return nil, err
+	}
+	if interaction.Response.Status == 0 {
+		return nil, errors.New(interaction.Response.Error)
+	}
+	response := responses.NewCommonResponse()
+	err = responses.Unmarshal(response, &http.Response{
+		StatusCode: interaction.Response.Status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(interaction.Response.Content)),
+	}, "JSON")
+	return response, err
+}
+
+func (r *Replayer) find(request *RecordedRequest) (*Interaction, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	match := strictMatch
+	if r.match == MatchLenient {
+		match = lenientMatch
+	}
+	// in lenient mode the last matching interaction answers again once all matching ones are used
+	var last *Interaction
+	for i, interaction := range r.interactions {
+		if !match(&interaction.Request, request) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return interaction, nil
+		}
+		last = interaction
+	}
+	if last == nil || r.match == MatchStrict {
+		return nil, fmt.Errorf("%w: %s", NoInteractionError, request.String())
+	}
+	return last, nil
+}
+
+func strictMatch(recorded, request *RecordedRequest) bool {
+	if recorded.Method != request.Method || recorded.Path != request.Path {
+		return false
+	}
+	if recorded.Input == nil || request.Input == nil {
+		return recorded.Input == request.Input
+	}
+	return recorded.Input.Method == request.Input.Method &&
+		recorded.Input.Path == request.Input.Path &&
+		recorded.Input.Content == request.Input.Content
+}
+
+func lenientMatch(recorded, request *RecordedRequest) bool {
+	if recorded.Input == nil || request.Input == nil {
+		return recorded.Input == request.Input && recorded.Path == request.Path
+	}
+	return recorded.Input.Method == request.Input.Method && trimQuery(recorded.Input.Path) == trimQuery(request.Input.Path)
+}
+
+func trimQuery(path string) string {
+	if i := strings.Index(path, "?"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+)
+
+type processorFunc func(request *requests.CommonRequest) (*responses.CommonResponse, error)
+
+func (f processorFunc) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	return f(request)
+}
+
+// signed adds what the SDK adds when signing a request, so the cassette sees credentials and volatile values.
+func signed(processor Processor) Processor {
+	nonce := 0
+	return processorFunc(func(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+		request.TransToAcsRequest()
+		nonce++
+		header := request.GetHeaders()
+		header["Authorization"] = "acs LTAI-secret-id:signature-secret"
+		header["x-acs-security-token"] = "sts-secret"
+		header["x-acs-signature-nonce"] = fmt.Sprint(nonce)
+		header["Date"] = fmt.Sprintf("Mon, 02 Jan 2006 15:04:%02d GMT", nonce)
+		query := request.GetQueryParams()
+		query["AccessKeyId"] = "LTAI-secret-id"
+		query["Signature"] = "signature-secret"
+		query["SignatureNonce"] = fmt.Sprint(nonce)
+		return processor.ProcessCommonRequest(request)
+	})
+}
+
+// answerWith answers every request with a Kubernetes response of body, the RequestIds count the requests from 0.
+func answerWith(body []byte) Processor {
+	calls := 0
+	return processorFunc(func(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+		id := fmt.Sprint(calls)
+		calls++
+		in := new(Input)
+		if err := json.Unmarshal(request.GetContent(), in); err != nil {
+			return nil, err
+		}
+		out := &Output{RequestId: id, Code: http.StatusOK, AcceptEncoding: EncodingGzip}
+		if err := out.EncodeBody(in, body); err != nil {
+			return nil, err
+		}
+		content, err := json.Marshal(out)
+		if err != nil {
+			return nil, err
+		}
+		return popResponse(http.StatusOK, string(content), nil)
+	})
+}
+
+// newPopRequest wraps a Kubernetes request into an envelope like a transport sharing compression.
+func newPopRequest(t *testing.T, host, method, path, body string, compression *Compression) *requests.CommonRequest {
+	t.Helper()
+	req, err := http.NewRequest(method, "https://"+host+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer kube-secret")
+	popReq := requests.NewCommonRequest()
+	if err = warpRequest(popReq, MetaRequestInjector{}, HttpRequestInjector{Request: req, Compression: compression}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = compression.compressRequest(popReq); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return popReq
+}
+
+type recordedCall struct {
+	method, path, body string
+}
+
+const endpoint = "sae.cn-hangzhou.aliyuncs.com"
+
+// record records calls into a new cassette, each answered with its index as RequestId.
+func record(t *testing.T, calls ...recordedCall) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := NewRecorder(filename, signed(answerWith([]byte(`{}`))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer recorder.Close()
+	for _, call := range calls {
+		if _, err = recorder.ProcessCommonRequest(newPopRequest(t, endpoint, call.method, call.path, call.body, nil)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	return filename
+}
+
+func TestRecorderScrubs(t *testing.T) {
+	filename := record(t, recordedCall{method: http.MethodGet, path: "/api/v1/namespaces/default/secrets"})
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"LTAI-secret-id", "signature-secret", "sts-secret", "kube-secret"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("expected %q to be scrubbed, got %s", secret, data)
+		}
+	}
+	interaction := new(Interaction)
+	if err = json.Unmarshal(data, interaction); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name   string
+		values map[string]string
+		key    string
+		want   string
+	}{
+		{name: "signature header", values: interaction.Request.Header, key: "Authorization", want: redacted},
+		{name: "security token header", values: interaction.Request.Header, key: "x-acs-security-token", want: redacted},
+		{name: "access key query", values: interaction.Request.Query, key: "AccessKeyId", want: redacted},
+		{name: "signature query", values: interaction.Request.Query, key: "Signature", want: redacted},
+		{name: "nonce header", values: interaction.Request.Header, key: "x-acs-signature-nonce"},
+		{name: "date header", values: interaction.Request.Header, key: "Date"},
+		{name: "nonce query", values: interaction.Request.Query, key: "SignatureNonce"},
+		{name: "Kubernetes header", values: map[string]string{"Authorization": interaction.Request.Input.Header["Authorization"][0]}, key: "Authorization", want: redacted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.values[tt.key]; got != tt.want {
+				t.Errorf("expected %s to be %q, got %q", tt.key, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestReplayerMatch(t *testing.T) {
+	var (
+		pods      = recordedCall{method: http.MethodGet, path: "/api/v1/namespaces/default/pods"}
+		pod       = recordedCall{method: http.MethodGet, path: "/api/v1/namespaces/default/pods/web"}
+		limited   = recordedCall{method: http.MethodGet, path: "/api/v1/namespaces/default/pods?limit=500"}
+		deletePod = recordedCall{method: http.MethodDelete, path: "/api/v1/namespaces/default/pods/web"}
+		createA   = recordedCall{method: http.MethodPost, path: "/api/v1/namespaces/default/configmaps", body: `{"metadata":{"name":"a"}}`}
+		createB   = recordedCall{method: http.MethodPost, path: "/api/v1/namespaces/default/configmaps", body: `{"metadata":{"name":"b"}}`}
+	)
+	tests := []struct {
+		name     string
+		match    MatchMode
+		recorded []recordedCall
+		replayed []recordedCall
+		host     string
+		// want are the RequestIds answering the replayed calls, empty for NoInteractionError
+		want []string
+	}{
+		{name: "strict in any order", match: MatchStrict, recorded: []recordedCall{pods, pod}, replayed: []recordedCall{pod, pods}, want: []string{"1", "0"}},
+		{name: "strict on another endpoint", match: MatchStrict, recorded: []recordedCall{pod}, replayed: []recordedCall{pod}, host: "127.0.0.1:8001", want: []string{"0"}},
+		{name: "strict compares the query", match: MatchStrict, recorded: []recordedCall{pods}, replayed: []recordedCall{limited}, want: []string{""}},
+		{name: "strict compares the body", match: MatchStrict, recorded: []recordedCall{createA}, replayed: []recordedCall{createB}, want: []string{""}},
+		{name: "strict uses interactions once", match: MatchStrict, recorded: []recordedCall{pod}, replayed: []recordedCall{pod, pod}, want: []string{"0", ""}},
+		{name: "strict uses equal interactions in order", match: MatchStrict, recorded: []recordedCall{pod, pod}, replayed: []recordedCall{pod, pod}, want: []string{"0", "1"}},
+		{name: "lenient ignores the query", match: MatchLenient, recorded: []recordedCall{pods}, replayed: []recordedCall{limited}, want: []string{"0"}},
+		{name: "lenient ignores the body", match: MatchLenient, recorded: []recordedCall{createA}, replayed: []recordedCall{createB}, want: []string{"0"}},
+		{name: "lenient compares the method", match: MatchLenient, recorded: []recordedCall{pod}, replayed: []recordedCall{deletePod}, want: []string{""}},
+		{name: "lenient reuses the last interaction", match: MatchLenient, recorded: []recordedCall{pod, pod}, replayed: []recordedCall{pod, pod, pod}, want: []string{"0", "1", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replayer, err := NewReplayer(record(t, tt.recorded...), tt.match)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			host := tt.host
+			if len(host) == 0 {
+				host = endpoint
+			}
+			for i, call := range tt.replayed {
+				response, err := replayer.ProcessCommonRequest(newPopRequest(t, host, call.method, call.path, call.body, nil))
+				if len(tt.want[i]) == 0 {
+					if !errors.Is(err, NoInteractionError) {
+						t.Errorf("call %d: expected %v, got %v", i, NoInteractionError, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("call %d: unexpected error: %v", i, err)
+				}
+				out := new(Output)
+				if err = out.unmarshal(response.GetHttpContentBytes()); err != nil {
+					t.Fatalf("call %d: unexpected error: %v", i, err)
+				}
+				if out.RequestId != tt.want[i] {
+					t.Errorf("call %d: expected RequestId %s, got %s", i, tt.want[i], out.RequestId)
+				}
+			}
+		})
+	}
+}
+
+func TestNewReplayerMatchMode(t *testing.T) {
+	if _, err := NewReplayer(record(t), "fuzzy"); err == nil || !strings.Contains(err.Error(), "unknown replay match") {
+		t.Errorf("expected an unknown replay match error, got %v", err)
+	}
+}
+
+// TestCassetteCompressed records compressed envelopes and replays them whether or not compression was negotiated.
+func TestCassetteCompressed(t *testing.T) {
+	manifest := `{"kind":"ConfigMap","data":{"key":"` + strings.Repeat("value ", 1024) + `"}}`
+	path := "/api/v1/namespaces/default/configmaps"
+	compression := &Compression{}
+	compression.learn(&Output{AcceptEncoding: EncodingGzip})
+
+	filename := filepath.Join(t.TempDir(), "cassette.jsonl")
+	recorder, err := NewRecorder(filename, signed(answerWith([]byte(manifest))))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	request := newPopRequest(t, endpoint, http.MethodPost, path, manifest, compression)
+	if in := new(Input); json.Unmarshal(request.GetContent(), in) != nil || in.ContentEncoding != EncodingGzip {
+		t.Fatalf("expected a compressed request, got %s", request.GetContent())
+	}
+	if _, err = recorder.ProcessCommonRequest(request); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interaction := new(Interaction)
+	if err = json.Unmarshal(data, interaction); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if in := interaction.Request.Input; in.ContentEncoding != "" || in.Content != manifest {
+		t.Errorf("expected the cassette to keep the plain content, got %q encoded as %q", in.Content, in.ContentEncoding)
+	}
+
+	tests := []struct {
+		name        string
+		compression *Compression
+	}{
+		{name: "compressed", compression: compression},
+		{name: "plain", compression: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replayer, err := NewReplayer(filename, MatchStrict)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			response, err := replayer.ProcessCommonRequest(newPopRequest(t, endpoint, http.MethodPost, path, manifest, tt.compression))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := new(Output)
+			if err = out.unmarshal(response.GetHttpContentBytes()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.ContentEncoding != EncodingGzip {
+				t.Errorf("expected the recorded compressed response, got encoding %q", out.ContentEncoding)
+			}
+			body, err := out.DecodeBody()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(body) != manifest {
+				t.Errorf("expected %s, got %s", manifest, body)
+			}
+		})
+	}
+}
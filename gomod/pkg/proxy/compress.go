@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+)
+
+const (
+	// EncodingBase64 is the content encoding of binary request contents, e.g. protobuf, which JSON strings can't hold
+	EncodingBase64 = "base64"
+	// EncodingGzip is the content encoding of compressed envelopes, the content is then base64 of the gzipped data
+	EncodingGzip = "gzip"
+
+	// compressThreshold is the smallest content worth compressing
+	compressThreshold = 1 << 10
+)
+
+// Compression negotiates the encodings of the envelope contents. Requests always accept compressed
+// response bodies, but are only compressed or base64 encoded once a response advertised that the server
+// accepts the encoding. A server unaware of encodings ignores the fields, so both directions fall back to
+// plain contents. A Compression is meant to be shared by the transports of a command, so the server is learned once.
+type Compression struct {
+	// Disabled neither compresses requests nor accepts compressed responses
+	Disabled bool
+
+	gzip   atomic.Bool
+	base64 atomic.Bool
+}
+
+// learn records which encodings the server accepts for the content of requests.
+func (c *Compression) learn(out *Output) {
+	if c == nil {
+		return
+	}
+	if acceptsEncoding(out.AcceptEncoding, EncodingGzip) {
+		c.gzip.Store(true)
+	}
+	if acceptsEncoding(out.AcceptEncoding, EncodingBase64) {
+		c.base64.Store(true)
+	}
+}
+
+// setContent sets the Kubernetes request body of the envelope. A binary body is only base64 encoded once the
+// server accepts that, a server unaware of contentEncoding would take the base64 text for the body itself.
+func (c *Compression) setContent(in *Input, data []byte) {
+	if c != nil && c.base64.Load() {
+		in.SetContent(data)
+		return
+	}
+	in.Content, in.ContentEncoding = string(data), ""
+}
+
+// compressRequest compresses the content of the envelope if the server accepts it,
+// and returns how many bytes that saved.
+func (c *Compression) compressRequest(request *requests.CommonRequest) (int, error) {
+	if c == nil || c.Disabled {
+		return 0, nil
+	}
+	in := new(Input)
+	if err := json.Unmarshal(request.GetContent(), in); err != nil {
+		return 0, fmt.Errorf("fail to decode request envelope: %v", err)
+	}
+	in.AcceptEncoding = EncodingGzip
+	saved := 0
+	if c.gzip.Load() && in.ContentEncoding != EncodingGzip && len(in.Content) >= compressThreshold {
+		raw, err := in.DecodeContent()
+		if err != nil {
+			return 0, err
+		}
+		data, err := gzipBytes(raw)
+		if err != nil {
+			return 0, err
+		}
+		plain, err := json.Marshal(in.Content)
+		if err != nil {
+			return 0, err
+		}
+		// two quotes enclose the base64 string in the envelope
+		if encoded := base64.StdEncoding.EncodeToString(data); len(encoded)+2 < len(plain) {
+			in.Content, in.ContentEncoding = encoded, EncodingGzip
+			saved = len(plain) - len(encoded) - 2
+		}
+	}
+	content, err := in.json()
+	if err != nil {
+		return 0, err
+	}
+	request.SetContent(content)
+	return saved, nil
+}
+
+// SetContent sets the Kubernetes request body of the envelope, base64 encoded unless it is text.
+// Requests are only encoded for a server accepting base64, see Compression.
+func (in *Input) SetContent(data []byte) {
+	if utf8.Valid(data) {
+		in.Content, in.ContentEncoding = string(data), ""
+		return
+	}
+	in.Content, in.ContentEncoding = base64.StdEncoding.EncodeToString(data), EncodingBase64
+}
+
+// DecodeContent returns the Kubernetes request body of the envelope.
+func (in *Input) DecodeContent() ([]byte, error) {
+	switch in.ContentEncoding {
+	case "":
+		return []byte(in.Content), nil
+	case EncodingBase64:
+		return base64.StdEncoding.DecodeString(in.Content)
+	case EncodingGzip:
+		data, err := base64.StdEncoding.DecodeString(in.Content)
+		if err != nil {
+			return nil, err
+		}
+		return gunzipBytes(data)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", in.ContentEncoding)
+}
+
+// DecodeBody returns the Kubernetes response body of the envelope.
+func (out *Output) DecodeBody() ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(out.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch out.ContentEncoding {
+	case "":
+		return data, nil
+	case EncodingGzip:
+		return gunzipBytes(data)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", out.ContentEncoding)
+}
+
+// EncodeBody sets the response body of the envelope, compressed if the request accepts it and that pays off.
+func (out *Output) EncodeBody(in *Input, body []byte) error {
+	out.Body, out.ContentEncoding = base64.StdEncoding.EncodeToString(body), ""
+	if !acceptsEncoding(in.AcceptEncoding, EncodingGzip) || len(body) < compressThreshold {
+		return nil
+	}
+	data, err := gzipBytes(body)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(body) {
+		out.Body, out.ContentEncoding = base64.StdEncoding.EncodeToString(data), EncodingGzip
+	}
+	return nil
+}
+
+func acceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, accepted := range strings.Split(acceptEncoding, ",") {
+		if strings.TrimSpace(accepted) == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipBytes(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+)
+
+// protobuf is a binary Kubernetes body, which is no valid UTF-8
+var protobuf = []byte{'k', '8', 's', 0x00, 0x0a, 0x0b, 0xff, 0xfe, 0x80}
+
+// sendContent wraps body into an envelope like a transport having learned from the advertisement of a response.
+func sendContent(t *testing.T, advertised string, body []byte) *Input {
+	t.Helper()
+	compression := &Compression{}
+	if len(advertised) != 0 {
+		compression.learn(&Output{AcceptEncoding: advertised})
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://sae.cn-hangzhou.aliyuncs.com/api/v1/namespaces/default/secrets", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	popReq := requests.NewCommonRequest()
+	if err = warpRequest(popReq, HttpRequestInjector{Request: req, Compression: compression}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	in := new(Input)
+	if err = json.Unmarshal(popReq.GetContent(), in); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return in
+}
+
+func TestRequestContentEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		advertised   string
+		body         []byte
+		wantEncoding string
+	}{
+		{name: "text", body: []byte(`{"kind":"Secret"}`)},
+		{name: "binary to a server unaware of encodings", body: protobuf},
+		{name: "binary to a server accepting gzip only", advertised: EncodingGzip, body: protobuf},
+		{name: "binary to a server accepting base64", advertised: EncodingGzip + ", " + EncodingBase64, body: protobuf, wantEncoding: EncodingBase64},
+		{name: "text to a server accepting base64", advertised: EncodingBase64, body: []byte(`{"kind":"Secret"}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := sendContent(t, tt.advertised, tt.body)
+			if in.ContentEncoding != tt.wantEncoding {
+				t.Fatalf("expected content encoding %q, got %q", tt.wantEncoding, in.ContentEncoding)
+			}
+			// a server unaware of encodings takes the content as it is, so only text and encoded bodies are kept
+			if len(tt.wantEncoding) == 0 && !utf8.Valid(tt.body) {
+				return
+			}
+			data, err := in.DecodeContent()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(data, tt.body) {
+				t.Errorf("expected %q, got %q", tt.body, data)
+			}
+		})
+	}
+}
+
+// negotiatingServer answers like a server advertising acceptEncoding and records the envelopes it received.
+type negotiatingServer struct {
+	acceptEncoding string
+	received       []*Input
+}
+
+func (s *negotiatingServer) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	in := new(Input)
+	if err := json.Unmarshal(request.GetContent(), in); err != nil {
+		return nil, err
+	}
+	s.received = append(s.received, in)
+	body, err := in.DecodeContent()
+	if err != nil {
+		return nil, err
+	}
+	out := &Output{RequestId: "echo", Code: http.StatusOK, AcceptEncoding: s.acceptEncoding}
+	// a server unaware of compression ignores the acceptEncoding of the request
+	accepted := *in
+	if len(s.acceptEncoding) == 0 {
+		accepted.AcceptEncoding = ""
+	}
+	if err = out.EncodeBody(&accepted, body); err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(out)
+	if err != nil {
+		return nil, err
+	}
+	return popResponse(http.StatusOK, string(content), nil)
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	manifest := `{"kind":"ConfigMap","data":{"key":"` + strings.Repeat("value ", 1024) + `"}}`
+	small := `{"kind":"ConfigMap"}`
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	incompressible := `{"data":"` + base64.StdEncoding.EncodeToString(random) + `"}`
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		disabled       bool
+		body           string
+		// wantEncodings are the content encodings of two requests, the first one negotiates
+		wantEncodings [2]string
+		wantAccept    string
+	}{
+		{name: "compressed once accepted", acceptEncoding: EncodingGzip, body: manifest, wantEncodings: [2]string{"", EncodingGzip}, wantAccept: EncodingGzip},
+		{name: "compressed once accepted among others", acceptEncoding: "br, gzip", body: manifest, wantEncodings: [2]string{"", EncodingGzip}, wantAccept: EncodingGzip},
+		{name: "server unaware of compression", body: manifest, wantAccept: EncodingGzip},
+		{name: "small content", acceptEncoding: EncodingGzip, body: small, wantAccept: EncodingGzip},
+		{name: "incompressible content", acceptEncoding: EncodingGzip, body: incompressible, wantAccept: EncodingGzip},
+		{name: "disabled", acceptEncoding: EncodingGzip, disabled: true, body: manifest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &negotiatingServer{acceptEncoding: tt.acceptEncoding}
+			rt := NewTransport(http.DefaultTransport, server, WithCompression(&Compression{Disabled: tt.disabled}))
+			for i := range tt.wantEncodings {
+				req, err := http.NewRequest(http.MethodPut, "https://sae.cn-hangzhou.aliyuncs.com/api/v1/namespaces/default/configmaps/web", strings.NewReader(tt.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				response, err := rt.RoundTrip(req)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				data, err := io.ReadAll(response.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != tt.body {
+					t.Errorf("request %d: expected the body to round trip, got %d bytes", i, len(data))
+				}
+				in := server.received[i]
+				if in.ContentEncoding != tt.wantEncodings[i] {
+					t.Errorf("request %d: expected content encoding %q, got %q", i, tt.wantEncodings[i], in.ContentEncoding)
+				}
+				if in.AcceptEncoding != tt.wantAccept {
+					t.Errorf("request %d: expected to accept %q, got %q", i, tt.wantAccept, in.AcceptEncoding)
+				}
+			}
+		})
+	}
+}
+
+func TestOutputEncodeBody(t *testing.T) {
+	large := []byte(strings.Repeat(`{"kind":"Pod"},`, 200))
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		body           []byte
+		wantEncoding   string
+	}{
+		{name: "accepted", acceptEncoding: EncodingGzip, body: large, wantEncoding: EncodingGzip},
+		{name: "accepted among others", acceptEncoding: "identity, gzip", body: large, wantEncoding: EncodingGzip},
+		{name: "not accepted", body: large},
+		{name: "other encoding accepted", acceptEncoding: "br", body: large},
+		{name: "below threshold", acceptEncoding: EncodingGzip, body: []byte(`{"kind":"Pod"}`)},
+		{name: "empty", acceptEncoding: EncodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(Output)
+			if err := out.EncodeBody(&Input{AcceptEncoding: tt.acceptEncoding}, tt.body); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.ContentEncoding != tt.wantEncoding {
+				t.Errorf("expected content encoding %q, got %q", tt.wantEncoding, out.ContentEncoding)
+			}
+			data, err := out.DecodeBody()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(data, tt.body) {
+				t.Errorf("expected the body to round trip, got %d bytes", len(data))
+			}
+		})
+	}
+}
+
+func TestDecodeUnsupportedEncoding(t *testing.T) {
+	if _, err := (&Input{Content: "x", ContentEncoding: "br"}).DecodeContent(); err == nil {
+		t.Error("expected an error for the content encoding br")
+	}
+	if _, err := (&Output{Body: "eA==", ContentEncoding: "br"}).DecodeBody(); err == nil {
+		t.Error("expected an error for the content encoding br")
+	}
+}
@@ -0,0 +1,180 @@
+package fake
+
+import (
+	"fmt"
+	"runtime"
+
+	openapi_v2 "github.com/google/gnostic/openapiv2"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+// Resource is a resource served by the fake, its Kind must be known to the client-go scheme.
+type Resource struct {
+	schema.GroupVersionResource
+	Kind       string
+	Namespaced bool
+	ShortNames []string
+	// Scalable resources serve the scale subresource backed by spec.replicas
+	Scalable bool
+}
+
+func (r *Resource) GroupVersionKind() schema.GroupVersionKind {
+	return r.GroupVersion().WithKind(r.Kind)
+}
+
+// DefaultResources are the resources SAE applications are managed with.
+var DefaultResources = []Resource{
+	{GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}, Kind: "Namespace", ShortNames: []string{"ns"}},
+	{GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "pods"}, Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}},
+	{GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "services"}, Kind: "Service", Namespaced: true, ShortNames: []string{"svc"}},
+	{GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, Kind: "ConfigMap", Namespaced: true, ShortNames: []string{"cm"}},
+	{GroupVersionResource: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, Kind: "Secret", Namespaced: true},
+	{GroupVersionResource: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Scalable: true},
+	{GroupVersionResource: schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "replicasets"}, Kind: "ReplicaSet", Namespaced: true, ShortNames: []string{"rs"}, Scalable: true},
+}
+
+var resourceVerbs = metav1.Verbs{"create", "delete", "get", "list", "patch", "update"}
+
+func (s *Server) resourceFor(gv schema.GroupVersion, name string) (*Resource, bool) {
+	for i := range s.Resources {
+		if r := &s.Resources[i]; r.GroupVersion() == gv && r.Resource == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// groupVersions lists the served group versions in the order of Resources.
+func (s *Server) groupVersions() []schema.GroupVersion {
+	var gvs []schema.GroupVersion
+	seen := map[schema.GroupVersion]bool{}
+	for _, r := range s.Resources {
+		if gv := r.GroupVersion(); !seen[gv] {
+			seen[gv] = true
+			gvs = append(gvs, gv)
+		}
+	}
+	return gvs
+}
+
+func (s *Server) apiVersions() *metav1.APIVersions {
+	versions := &metav1.APIVersions{TypeMeta: metav1.TypeMeta{Kind: "APIVersions"}}
+	for _, gv := range s.groupVersions() {
+		if len(gv.Group) == 0 {
+			versions.Versions = append(versions.Versions, gv.Version)
+		}
+	}
+	return versions
+}
+
+func (s *Server) apiGroupList() *metav1.APIGroupList {
+	list := &metav1.APIGroupList{TypeMeta: metav1.TypeMeta{Kind: "APIGroupList", APIVersion: "v1"}}
+	index := map[string]int{}
+	for _, gv := range s.groupVersions() {
+		if len(gv.Group) == 0 {
+			continue
+		}
+		version := metav1.GroupVersionForDiscovery{GroupVersion: gv.String(), Version: gv.Version}
+		i, ok := index[gv.Group]
+		if !ok {
+			i = len(list.Groups)
+			index[gv.Group] = i
+			list.Groups = append(list.Groups, metav1.APIGroup{Name: gv.Group, PreferredVersion: version})
+		}
+		list.Groups[i].Versions = append(list.Groups[i].Versions, version)
+	}
+	return list
+}
+
+func (s *Server) apiResourceList(gv schema.GroupVersion) (*metav1.APIResourceList, bool) {
+	list := &metav1.APIResourceList{TypeMeta: metav1.TypeMeta{Kind: "APIResourceList", APIVersion: "v1"}, GroupVersion: gv.String()}
+	for _, r := range s.Resources {
+		if r.GroupVersion() != gv {
+			continue
+		}
+		list.APIResources = append(list.APIResources, metav1.APIResource{
+			Name:       r.Resource,
+			Namespaced: r.Namespaced,
+			Kind:       r.Kind,
+			Verbs:      resourceVerbs,
+			ShortNames: r.ShortNames,
+		})
+		if r.Scalable {
+			list.APIResources = append(list.APIResources, metav1.APIResource{
+				Name:       r.Resource + "/scale",
+				Namespaced: r.Namespaced,
+				Group:      "autoscaling",
+				Version:    "v1",
+				Kind:       "Scale",
+				Verbs:      metav1.Verbs{"get", "patch", "update"},
+			})
+		}
+	}
+	return list, len(list.APIResources) != 0
+}
+
+func serverVersion() *version.Info {
+	return &version.Info{
+		Major:      "1",
+		Minor:      "25",
+		GitVersion: "v1.25.4-sae-fake",
+		Platform:   fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+// openAPI builds a minimal OpenAPI v2 document in protobuf. It only declares which query
+// parameters PATCH accepts, which kubectl checks before dry-run and field validation;
+// without definitions kubectl falls back to the compiled-in types for patches.
+func (s *Server) openAPI() ([]byte, error) {
+	doc := &openapi_v2.Document{
+		Swagger: "2.0",
+		Info:    &openapi_v2.Info{Title: "SAE fake", Version: serverVersion().GitVersion},
+		Paths:   &openapi_v2.Paths{},
+	}
+	for _, r := range s.Resources {
+		path := "/api/" + r.Version
+		if len(r.Group) != 0 {
+			path = "/apis/" + r.Group + "/" + r.Version
+		}
+		if r.Namespaced {
+			path += "/namespaces/{namespace}"
+		}
+		path += "/" + r.Resource + "/{name}"
+		gvk := fmt.Sprintf("group: %q\nkind: %s\nversion: %s\n", r.Group, r.Kind, r.Version)
+		doc.Paths.Path = append(doc.Paths.Path, &openapi_v2.NamedPathItem{
+			Name: path,
+			Value: &openapi_v2.PathItem{
+				Patch: &openapi_v2.Operation{
+					Parameters: []*openapi_v2.ParametersItem{
+						queryParameter("dryRun"),
+						queryParameter("fieldManager"),
+						queryParameter("fieldValidation"),
+					},
+					VendorExtension: []*openapi_v2.NamedAny{
+						{Name: "x-kubernetes-group-version-kind", Value: &openapi_v2.Any{Yaml: gvk}},
+					},
+				},
+			},
+		})
+	}
+	return proto.Marshal(doc)
+}
+
+func queryParameter(name string) *openapi_v2.ParametersItem {
+	return &openapi_v2.ParametersItem{
+		Oneof: &openapi_v2.ParametersItem_Parameter{
+			Parameter: &openapi_v2.Parameter{
+				Oneof: &openapi_v2.Parameter_NonBodyParameter{
+					NonBodyParameter: &openapi_v2.NonBodyParameter{
+						Oneof: &openapi_v2.NonBodyParameter_QueryParameterSubSchema{
+							QueryParameterSubSchema: &openapi_v2.QueryParameterSubSchema{In: "query", Name: name, Type: "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
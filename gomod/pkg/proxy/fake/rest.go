@@ -0,0 +1,496 @@
+package fake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// request is the Kubernetes request carried by the envelope.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   []byte
+}
+
+func (r *request) dryRun() bool {
+	return len(r.query["dryRun"]) != 0
+}
+
+type response struct {
+	code   int
+	header http.Header
+	body   []byte
+}
+
+func (s *Server) serve(req *request) *response {
+	switch req.path {
+	case "/version":
+		return jsonResponse(http.StatusOK, serverVersion())
+	case "/openapi/v2":
+		data, err := s.openAPI()
+		if err != nil {
+			return errorResponse(err)
+		}
+		return &response{code: http.StatusOK, header: http.Header{"Content-Type": {"application/octet-stream"}}, body: data}
+	case "/api":
+		return jsonResponse(http.StatusOK, s.apiVersions())
+	case "/apis":
+		return jsonResponse(http.StatusOK, s.apiGroupList())
+	}
+
+	var gv schema.GroupVersion
+	parts := strings.Split(strings.Trim(req.path, "/"), "/")
+	switch {
+	case parts[0] == "api" && len(parts) >= 2:
+		gv, parts = schema.GroupVersion{Version: parts[1]}, parts[2:]
+	case parts[0] == "apis" && len(parts) >= 3:
+		gv, parts = schema.GroupVersion{Group: parts[1], Version: parts[2]}, parts[3:]
+	default:
+		return notFound()
+	}
+	if len(parts) == 0 {
+		list, ok := s.apiResourceList(gv)
+		if !ok {
+			return notFound()
+		}
+		return jsonResponse(http.StatusOK, list)
+	}
+
+	namespace := ""
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		if r, ok := s.resourceFor(gv, parts[2]); ok && r.Namespaced {
+			namespace, parts = parts[1], parts[2:]
+		}
+	}
+	r, ok := s.resourceFor(gv, parts[0])
+	if !ok || len(parts) > 3 {
+		return notFound()
+	}
+	var name, subresource string
+	if len(parts) > 1 {
+		name = parts[1]
+	}
+	if len(parts) > 2 {
+		subresource = parts[2]
+	}
+
+	switch {
+	case subresource == "scale" && r.Scalable:
+		return s.scale(req, r, namespace, name)
+	case len(subresource) != 0:
+		return notFound()
+	case len(name) == 0 && req.method == http.MethodGet:
+		return s.list(req, r, namespace)
+	case len(name) == 0 && req.method == http.MethodPost:
+		return s.create(req, r, namespace)
+	case len(name) != 0 && req.method == http.MethodGet:
+		return s.get(r, namespace, name)
+	case len(name) != 0 && req.method == http.MethodPut:
+		return s.replace(req, r, namespace, name)
+	case len(name) != 0 && req.method == http.MethodPatch:
+		return s.patch(req, r, namespace, name)
+	case len(name) != 0 && req.method == http.MethodDelete:
+		return s.delete(req, r, namespace, name)
+	}
+	return errorResponse(apierrors.NewMethodNotSupported(r.GroupResource(), strings.ToLower(req.method)))
+}
+
+func (s *Server) get(r *Resource, namespace, name string) *response {
+	obj, err := s.tracker.Get(r.GroupVersionResource, namespace, name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return objectResponse(http.StatusOK, r.GroupVersionKind(), obj)
+}
+
+func (s *Server) list(req *request, r *Resource, namespace string) *response {
+	if w := req.query.Get("watch"); w == "true" || w == "1" {
+		return errorResponse(apierrors.NewMethodNotSupported(r.GroupResource(), "watch"))
+	}
+	labelSelector, err := labels.Parse(req.query.Get("labelSelector"))
+	if err != nil {
+		return errorResponse(apierrors.NewBadRequest(err.Error()))
+	}
+	fieldSelector, err := fields.ParseSelector(req.query.Get("fieldSelector"))
+	if err != nil {
+		return errorResponse(apierrors.NewBadRequest(err.Error()))
+	}
+
+	s.lock.Lock()
+	resourceVersion := s.resourceVersion
+	s.lock.Unlock()
+	list, err := s.tracker.List(r.GroupVersionResource, r.GroupVersionKind(), namespace)
+	if err != nil {
+		return errorResponse(err)
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return errorResponse(err)
+	}
+	var filtered []runtime.Object
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return errorResponse(err)
+		}
+		itemFields := fields.Set{"metadata.name": accessor.GetName(), "metadata.namespace": accessor.GetNamespace()}
+		if labelSelector.Matches(labels.Set(accessor.GetLabels())) && fieldSelector.Matches(itemFields) {
+			filtered = append(filtered, item)
+		}
+	}
+	if err = meta.SetList(list, filtered); err != nil {
+		return errorResponse(err)
+	}
+	listAccessor, err := meta.ListAccessor(list)
+	if err != nil {
+		return errorResponse(err)
+	}
+	listAccessor.SetResourceVersion(fmt.Sprint(resourceVersion))
+	return objectResponse(http.StatusOK, r.GroupVersion().WithKind(r.Kind+"List"), list)
+}
+
+func (s *Server) create(req *request, r *Resource, namespace string) *response {
+	obj, accessor, err := s.decode(r, req.body)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if len(accessor.GetName()) == 0 && len(accessor.GetGenerateName()) != 0 {
+		accessor.SetName(accessor.GetGenerateName() + utilrand.String(5))
+	}
+	if len(accessor.GetName()) == 0 {
+		return errorResponse(apierrors.NewBadRequest("name or generateName is required"))
+	}
+	if err = checkNamespace(r, accessor, namespace); err != nil {
+		return errorResponse(err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err = s.tracker.Get(r.GroupVersionResource, namespace, accessor.GetName()); err == nil {
+		return errorResponse(apierrors.NewAlreadyExists(r.GroupResource(), accessor.GetName()))
+	}
+	accessor.SetUID("")
+	accessor.SetCreationTimestamp(metav1.Time{})
+	accessor.SetGeneration(0)
+	s.initObjectMeta(accessor)
+	if req.dryRun() {
+		accessor.SetResourceVersion("")
+	} else if err = s.tracker.Create(r.GroupVersionResource, obj, namespace); err != nil {
+		return errorResponse(err)
+	}
+	return objectResponse(http.StatusCreated, r.GroupVersionKind(), obj)
+}
+
+func (s *Server) replace(req *request, r *Resource, namespace, name string) *response {
+	obj, accessor, err := s.decode(r, req.body)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if accessor.GetName() != name {
+		return errorResponse(apierrors.NewBadRequest("the name of the object does not match the name on the URL"))
+	}
+	if err = checkNamespace(r, accessor, namespace); err != nil {
+		return errorResponse(err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, err := s.tracker.Get(r.GroupVersionResource, namespace, name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = s.update(req, r, current, obj); err != nil {
+		return errorResponse(err)
+	}
+	return objectResponse(http.StatusOK, r.GroupVersionKind(), obj)
+}
+
+func (s *Server) patch(req *request, r *Resource, namespace, name string) *response {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, err := s.tracker.Get(r.GroupVersionResource, namespace, name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	original, err := encode(r.GroupVersionKind(), current)
+	if err != nil {
+		return errorResponse(err)
+	}
+	dataStruct, err := s.scheme.New(r.GroupVersionKind())
+	if err != nil {
+		return errorResponse(err)
+	}
+	patched, err := applyPatch(req, original, dataStruct)
+	if err != nil {
+		return errorResponse(err)
+	}
+	obj, accessor, err := s.decode(r, patched)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if accessor.GetName() != name || accessor.GetNamespace() != namespace {
+		return errorResponse(apierrors.NewBadRequest("name and namespace can't be patched"))
+	}
+	if err = s.update(req, r, current, obj); err != nil {
+		return errorResponse(err)
+	}
+	return objectResponse(http.StatusOK, r.GroupVersionKind(), obj)
+}
+
+func (s *Server) delete(req *request, r *Resource, namespace, name string) *response {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	obj, err := s.tracker.Get(r.GroupVersionResource, namespace, name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if !req.dryRun() {
+		if err = s.tracker.Delete(r.GroupVersionResource, namespace, name); err != nil {
+			return errorResponse(err)
+		}
+	}
+	return objectResponse(http.StatusOK, r.GroupVersionKind(), obj)
+}
+
+// scale serves the autoscaling/v1 Scale of a resource, backed by its spec.replicas.
+func (s *Server) scale(req *request, r *Resource, namespace, name string) *response {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	current, err := s.tracker.Get(r.GroupVersionResource, namespace, name)
+	if err != nil {
+		return errorResponse(err)
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	if err != nil {
+		return errorResponse(err)
+	}
+	scale, err := toScale(&unstructured.Unstructured{Object: content})
+	if err != nil {
+		return errorResponse(err)
+	}
+	scaleGVK := autoscalingv1.SchemeGroupVersion.WithKind("Scale")
+
+	newScale := &autoscalingv1.Scale{}
+	switch req.method {
+	case http.MethodGet:
+		return objectResponse(http.StatusOK, scaleGVK, scale)
+	case http.MethodPut:
+		if err = json.Unmarshal(req.body, newScale); err != nil {
+			return errorResponse(apierrors.NewBadRequest(err.Error()))
+		}
+	case http.MethodPatch:
+		original, err := encode(scaleGVK, scale)
+		if err != nil {
+			return errorResponse(err)
+		}
+		patched, err := applyPatch(req, original, &autoscalingv1.Scale{})
+		if err != nil {
+			return errorResponse(err)
+		}
+		if err = json.Unmarshal(patched, newScale); err != nil {
+			return errorResponse(apierrors.NewBadRequest(err.Error()))
+		}
+	default:
+		return errorResponse(apierrors.NewMethodNotSupported(r.GroupResource(), strings.ToLower(req.method)))
+	}
+	if rv := newScale.ResourceVersion; len(rv) != 0 && rv != scale.ResourceVersion {
+		return errorResponse(conflict(r, name))
+	}
+
+	if err = unstructured.SetNestedField(content, int64(newScale.Spec.Replicas), "spec", "replicas"); err != nil {
+		return errorResponse(err)
+	}
+	obj, err := s.scheme.New(r.GroupVersionKind())
+	if err != nil {
+		return errorResponse(err)
+	}
+	if err = runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj); err != nil {
+		return errorResponse(err)
+	}
+	if err = s.update(req, r, current, obj); err != nil {
+		return errorResponse(err)
+	}
+	accessor, _ := meta.Accessor(obj)
+	scale.Spec.Replicas = newScale.Spec.Replicas
+	scale.ResourceVersion = accessor.GetResourceVersion()
+	return objectResponse(http.StatusOK, scaleGVK, scale)
+}
+
+func toScale(obj *unstructured.Unstructured) (*autoscalingv1.Scale, error) {
+	replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		replicas = 1
+	}
+	statusReplicas, _, _ := unstructured.NestedInt64(obj.Object, "status", "replicas")
+	selector := ""
+	if m, found, _ := unstructured.NestedMap(obj.Object, "spec", "selector"); found {
+		labelSelector := &metav1.LabelSelector{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(m, labelSelector); err != nil {
+			return nil, err
+		}
+		s, err := metav1.LabelSelectorAsSelector(labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		selector = s.String()
+	}
+	return &autoscalingv1.Scale{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              obj.GetName(),
+			Namespace:         obj.GetNamespace(),
+			UID:               obj.GetUID(),
+			ResourceVersion:   obj.GetResourceVersion(),
+			CreationTimestamp: obj.GetCreationTimestamp(),
+		},
+		Spec:   autoscalingv1.ScaleSpec{Replicas: int32(replicas)},
+		Status: autoscalingv1.ScaleStatus{Replicas: int32(statusReplicas), Selector: selector},
+	}, nil
+}
+
+// update replaces current by obj, keeping the fields owned by the server. The caller must hold the lock.
+func (s *Server) update(req *request, r *Resource, current, obj runtime.Object) error {
+	currentAccessor, err := meta.Accessor(current)
+	if err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	if rv := accessor.GetResourceVersion(); len(rv) != 0 && rv != currentAccessor.GetResourceVersion() {
+		return conflict(r, accessor.GetName())
+	}
+	accessor.SetUID(currentAccessor.GetUID())
+	accessor.SetCreationTimestamp(currentAccessor.GetCreationTimestamp())
+	accessor.SetGeneration(currentAccessor.GetGeneration())
+	// dry runs are not persisted, so they don't get a new resource version either
+	if req.dryRun() {
+		accessor.SetResourceVersion(currentAccessor.GetResourceVersion())
+		return nil
+	}
+	accessor.SetResourceVersion(s.nextResourceVersion())
+	return s.tracker.Update(r.GroupVersionResource, obj, accessor.GetNamespace())
+}
+
+func conflict(r *Resource, name string) error {
+	return apierrors.NewConflict(r.GroupResource(), name, errors.New("the object has been modified; please apply your changes to the latest version and try again"))
+}
+
+func (s *Server) decode(r *Resource, data []byte) (runtime.Object, metav1.Object, error) {
+	obj, err := s.scheme.New(r.GroupVersionKind())
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = json.Unmarshal(data, obj); err != nil {
+		return nil, nil, apierrors.NewBadRequest(err.Error())
+	}
+	if gvk := obj.GetObjectKind().GroupVersionKind(); !gvk.Empty() && gvk != r.GroupVersionKind() {
+		return nil, nil, apierrors.NewBadRequest(fmt.Sprintf("%s does not match the expected %s", gvk, r.GroupVersionKind()))
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	return obj, accessor, nil
+}
+
+func checkNamespace(r *Resource, accessor metav1.Object, namespace string) error {
+	if !r.Namespaced {
+		accessor.SetNamespace("")
+		return nil
+	}
+	if len(accessor.GetNamespace()) == 0 {
+		accessor.SetNamespace(namespace)
+	}
+	if accessor.GetNamespace() != namespace {
+		return apierrors.NewBadRequest("the namespace of the provided object does not match the namespace sent on the request")
+	}
+	return nil
+}
+
+func applyPatch(req *request, original []byte, dataStruct runtime.Object) ([]byte, error) {
+	contentType, _, _ := mime.ParseMediaType(req.header.Get("Content-Type"))
+	var (
+		patched []byte
+		err     error
+	)
+	switch types.PatchType(contentType) {
+	case types.JSONPatchType:
+		patch, decodeErr := jsonpatch.DecodePatch(req.body)
+		if decodeErr != nil {
+			return nil, apierrors.NewBadRequest(decodeErr.Error())
+		}
+		patched, err = patch.Apply(original)
+	case types.MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, req.body)
+	case types.StrategicMergePatchType:
+		patched, err = strategicpatch.StrategicMergePatch(original, req.body, dataStruct)
+	default:
+		return nil, apierrors.NewGenericServerResponse(http.StatusUnsupportedMediaType, "patch", schema.GroupResource{}, "", fmt.Sprintf("patch type %q is not supported", contentType), 0, false)
+	}
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return patched, nil
+}
+
+func encode(gvk schema.GroupVersionKind, obj runtime.Object) ([]byte, error) {
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	return json.Marshal(obj)
+}
+
+func objectResponse(code int, gvk schema.GroupVersionKind, obj runtime.Object) *response {
+	data, err := encode(gvk, obj)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return &response{code: code, header: http.Header{"Content-Type": {"application/json"}}, body: data}
+}
+
+func jsonResponse(code int, obj interface{}) *response {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return errorResponse(err)
+	}
+	return &response{code: code, header: http.Header{"Content-Type": {"application/json"}}, body: data}
+}
+
+func notFound() *response {
+	return errorResponse(apierrors.NewGenericServerResponse(http.StatusNotFound, "", schema.GroupResource{}, "", "the server could not find the requested resource", 0, false))
+}
+
+func errorResponse(err error) *response {
+	var status metav1.Status
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		status = apiStatus.Status()
+	} else {
+		status = apierrors.NewInternalError(err).Status()
+	}
+	status.Kind, status.APIVersion = "Status", "v1"
+	data, _ := json.Marshal(&status)
+	return &response{code: int(status.Code), header: http.Header{"Content-Type": {"application/json"}}, body: data}
+}
@@ -0,0 +1,159 @@
+// Package fake implements the SAE VirtualServerProxy protocol on top of an in-memory
+// object tracker, so commands can run end-to-end without the real POP endpoint.
+//
+// Point a client at it with the URL of a started server:
+//
+//	s := fake.NewServer(&appsv1.Deployment{...})
+//	ts := s.Start()
+//	defer ts.Close()
+//	saectl --server=ts.URL --access-key-id=fake --access-key-secret=fake get deployments
+package fake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/testing"
+
+	"saectl/pkg/proxy"
+)
+
+// Server is an in-memory SAE endpoint, objects are kept by a client-go ObjectTracker.
+// Resources may be changed before the server handles its first request.
+type Server struct {
+	Resources []Resource
+	// DisableCompression serves like a server unaware of compressed envelopes
+	DisableCompression bool
+
+	scheme  *runtime.Scheme
+	tracker testing.ObjectTracker
+
+	// lock serializes writes so that resource versions are checked and assigned consistently
+	lock            sync.Mutex
+	resourceVersion int64
+}
+
+var _ http.Handler = &Server{}
+
+// NewServer returns a server serving DefaultResources and holding objects, it panics if an object can't be added.
+func NewServer(objects ...runtime.Object) *Server {
+	s := &Server{
+		Resources: DefaultResources,
+		scheme:    clientgoscheme.Scheme,
+		tracker:   testing.NewObjectTracker(clientgoscheme.Scheme, clientgoscheme.Codecs.UniversalDecoder()),
+	}
+	for _, obj := range objects {
+		if err := s.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+// Add stores a copy of obj as if it had been created through the API.
+func (s *Server) Add(obj runtime.Object) error {
+	obj = obj.DeepCopyObject()
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.initObjectMeta(accessor)
+	return s.tracker.Add(obj)
+}
+
+// Tracker gives direct access to the stored objects, e.g. for assertions.
+func (s *Server) Tracker() testing.ObjectTracker {
+	return s.tracker
+}
+
+// Start serves on a local port, the URL of the returned server is meant for --server.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+// ServeHTTP unwraps the Kubernetes request from the POP envelope and wraps the response in turn.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != proxy.SAEYamlPathPattern {
+		http.NotFound(w, r)
+		return
+	}
+	in := new(proxy.Input)
+	if err := json.NewDecoder(r.Body).Decode(in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := in.DecodeContent()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	u, err := url.Parse(in.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the envelope fields win over the headers, like they do for SAE
+	header := http.Header(in.Header).Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if len(in.ContentType) != 0 {
+		header.Set("Content-Type", in.ContentType)
+	}
+	if len(in.Accept) != 0 {
+		header.Set("Accept", in.Accept)
+	}
+	resp := s.serve(&request{
+		method: in.Method,
+		path:   u.Path,
+		query:  u.Query(),
+		header: header,
+		body:   body,
+	})
+	out := &proxy.Output{
+		RequestId:      string(uuid.NewUUID()),
+		Code:           resp.code,
+		Header:         resp.header,
+		AcceptEncoding: proxy.EncodingGzip + ", " + proxy.EncodingBase64,
+	}
+	if s.DisableCompression {
+		out.AcceptEncoding = ""
+		in.AcceptEncoding = ""
+	}
+	if err := out.EncodeBody(in, resp.body); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// initObjectMeta fills the fields the API server owns, the caller must hold the lock.
+func (s *Server) initObjectMeta(accessor metav1.Object) {
+	if len(accessor.GetUID()) == 0 {
+		accessor.SetUID(uuid.NewUUID())
+	}
+	if accessor.GetCreationTimestamp().Time.IsZero() {
+		accessor.SetCreationTimestamp(metav1.Now())
+	}
+	if accessor.GetGeneration() == 0 {
+		accessor.SetGeneration(1)
+	}
+	accessor.SetResourceVersion(s.nextResourceVersion())
+}
+
+func (s *Server) nextResourceVersion() string {
+	s.resourceVersion++
+	return strconv.FormatInt(s.resourceVersion, 10)
+}
@@ -0,0 +1,359 @@
+package fake_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	cmdutil "k8s.io/kubectl/pkg/cmd/util"
+
+	"saectl/cmd/help"
+	"saectl/internal/cmd/annotate"
+	"saectl/internal/cmd/apply"
+	"saectl/internal/cmd/delete"
+	"saectl/internal/cmd/diff"
+	"saectl/internal/cmd/get"
+	"saectl/internal/cmd/label"
+	"saectl/internal/cmd/scale"
+	"saectl/internal/cmd/util"
+	"saectl/pkg/options"
+	"saectl/pkg/proxy/fake"
+)
+
+var deploymentsResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+
+func newDeployment(name string, replicas int32) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "main", Image: "nginx:1.23"}},
+				},
+			},
+		},
+	}
+}
+
+const manifest = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: %s
+  namespace: default
+spec:
+  replicas: %d
+  selector:
+    matchLabels:
+      app: %[1]s
+  template:
+    metadata:
+      labels:
+        app: %[1]s
+    spec:
+      containers:
+      - name: main
+        image: %[3]s
+`
+
+func writeManifest(t *testing.T, name string, replicas int, image string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name+".yaml")
+	if err := os.WriteFile(filename, []byte(fmt.Sprintf(manifest, name, replicas, image)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+type newCmdFunc func(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command
+
+// fatalError is raised by a command failing through cmdutil.CheckErr
+type fatalError struct {
+	msg  string
+	code int
+}
+
+func (e fatalError) Error() string {
+	return fmt.Sprintf("exit code %d: %s", e.code, e.msg)
+}
+
+// saectl runs a saectl command against s started for it, the flags of options.Config are parsed with the command
+// as in: saectl CMD ARGS --server=URL --access-key-id=fake --access-key-secret=fake --region=cn-hangzhou -n default
+func saectl(t *testing.T, s *fake.Server, newCmd newCmdFunc, args ...string) (out string, err error) {
+	t.Helper()
+	ts := s.Start()
+	defer ts.Close()
+	dir := t.TempDir()
+	t.Setenv("SAECACHEDIR", filepath.Join(dir, "cache"))
+
+	config := options.NewConfig()
+	root := &cobra.Command{Use: help.RootCommand}
+	config.AddFlags(root.PersistentFlags())
+	streams, _, stdout, stderr := genericclioptions.NewTestIOStreams()
+	cmd := newCmd(util.NewAliCloudFactory(config).NewCmdFactory(), streams)
+	root.AddCommand(cmd)
+	root.SetArgs(append(append([]string{cmd.Name()}, args...),
+		"--server="+ts.URL,
+		"--access-key-id=fake",
+		"--access-key-secret=fake",
+		"--region=cn-hangzhou",
+		"--saeconfig="+filepath.Join(dir, "config"),
+		"-n", "default",
+	))
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+
+	cmdutil.BehaviorOnFatal(func(msg string, code int) {
+		panic(fatalError{msg: msg, code: code})
+	})
+	defer cmdutil.DefaultBehaviorOnFatal()
+	defer func() {
+		if r := recover(); r != nil {
+			fatal, ok := r.(fatalError)
+			if !ok {
+				panic(r)
+			}
+			out, err = stdout.String(), fatal
+		}
+	}()
+	err = root.Execute()
+	return stdout.String(), err
+}
+
+func getDeployment(t *testing.T, s *fake.Server, name string) *appsv1.Deployment {
+	t.Helper()
+	obj, err := s.Tracker().Get(deploymentsResource, "default", name)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return obj.(*appsv1.Deployment)
+}
+
+func newGet(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return get.NewCmdGet("saectl", f, streams)
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantOut string
+		wantErr string
+	}{
+		{name: "by name", args: []string{"deployment", "web", "-o", "jsonpath={.spec.replicas}"}, wantOut: "1"},
+		{name: "by label", args: []string{"deployments", "-l", "app=web", "-o", "name"}, wantOut: "deployment.apps/web\n"},
+		{name: "missing", args: []string{"deployment", "missing"}, wantErr: `deployments.apps "missing" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := saectl(t, fake.NewServer(newDeployment("web", 1), newDeployment("api", 2)), newGet, tt.args...)
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.wantOut {
+				t.Errorf("expected %q, got %q", tt.wantOut, out)
+			}
+		})
+	}
+}
+
+func newApply(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return apply.NewCmdApply("saectl", f, streams)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name      string
+		objects   []*appsv1.Deployment
+		wantOut   string
+		wantImage string
+	}{
+		{name: "creates", wantOut: "deployment.apps/web created\n", wantImage: "nginx:1.25"},
+		{name: "patches", objects: []*appsv1.Deployment{newDeployment("web", 1)}, wantOut: "deployment.apps/web configured\n", wantImage: "nginx:1.25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fake.NewServer()
+			for _, obj := range tt.objects {
+				if err := s.Add(obj); err != nil {
+					t.Fatal(err)
+				}
+			}
+			out, err := saectl(t, s, newApply, "-f", writeManifest(t, "web", 1, "nginx:1.25"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.wantOut {
+				t.Errorf("expected %q, got %q", tt.wantOut, out)
+			}
+			if image := getDeployment(t, s, "web").Spec.Template.Spec.Containers[0].Image; image != tt.wantImage {
+				t.Errorf("expected image %s, got %s", tt.wantImage, image)
+			}
+		})
+	}
+}
+
+func newDiff(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return diff.NewCmdDiff(f, streams)
+}
+
+// TestDiff diffs through a server-side dry run, which must leave the live object alone.
+func TestDiff(t *testing.T) {
+	// diff exits with 1 when it finds differences, which would end the test
+	script := filepath.Join(t.TempDir(), "diff")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ndiff -u -N \"$@\"\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECTL_EXTERNAL_DIFF", script)
+
+	s := fake.NewServer(newDeployment("web", 1))
+	out, err := saectl(t, s, newDiff, "-f", writeManifest(t, "web", 5, "nginx:1.23"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out, "-  replicas: 1") || !strings.Contains(out, "+  replicas: 5") {
+		t.Errorf("expected the replicas to differ, got %s", out)
+	}
+	if replicas := *getDeployment(t, s, "web").Spec.Replicas; replicas != 1 {
+		t.Errorf("expected the dry run to keep 1 replica, got %d", replicas)
+	}
+}
+
+func newDelete(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return delete.NewCmdDelete(f, streams)
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantOut string
+		wantErr string
+	}{
+		{name: "existing", args: []string{"deployment", "web"}, wantOut: "deployment.apps \"web\" deleted\n"},
+		{name: "missing", args: []string{"deployment", "missing"}, wantErr: `deployments.apps "missing" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fake.NewServer(newDeployment("web", 1))
+			out, err := saectl(t, s, newDelete, tt.args...)
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out != tt.wantOut {
+				t.Errorf("expected %q, got %q", tt.wantOut, out)
+			}
+			if _, err = s.Tracker().Get(deploymentsResource, "default", "web"); !apierrors.IsNotFound(err) {
+				t.Errorf("expected not found after delete, got %v", err)
+			}
+		})
+	}
+}
+
+func newScale(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return scale.NewCmdScale(f, streams)
+}
+
+func TestScale(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantReplicas int32
+		wantErr      string
+	}{
+		{name: "replicas", args: []string{"deployment", "web", "--replicas=3"}, wantReplicas: 3},
+		{name: "current replicas", args: []string{"deployment", "web", "--current-replicas=1", "--replicas=4"}, wantReplicas: 4},
+		{name: "stale current replicas", args: []string{"deployment", "web", "--current-replicas=2", "--replicas=4"}, wantReplicas: 1, wantErr: "Expected replicas to be 2, was 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fake.NewServer(newDeployment("web", 1))
+			_, err := saectl(t, s, newScale, tt.args...)
+			if len(tt.wantErr) != 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected %q, got %v", tt.wantErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if replicas := *getDeployment(t, s, "web").Spec.Replicas; replicas != tt.wantReplicas {
+				t.Errorf("expected %d replicas, got %d", tt.wantReplicas, replicas)
+			}
+		})
+	}
+}
+
+func newLabel(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return label.NewCmdLabel(f, streams)
+}
+
+func newAnnotate(f cmdutil.Factory, streams genericclioptions.IOStreams) *cobra.Command {
+	return annotate.NewCmdAnnotate("saectl", f, streams)
+}
+
+// TestMetadata runs label and annotate, which send merge patches of the metadata.
+func TestMetadata(t *testing.T) {
+	tests := []struct {
+		name            string
+		newCmd          newCmdFunc
+		args            []string
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+	}{
+		{
+			name:       "label",
+			newCmd:     newLabel,
+			args:       []string{"deployment", "web", "tier=frontend", "app-"},
+			wantLabels: map[string]string{"tier": "frontend"},
+		},
+		{
+			name:            "annotate",
+			newCmd:          newAnnotate,
+			args:            []string{"deployment", "web", "owner=team-a"},
+			wantLabels:      map[string]string{"app": "web"},
+			wantAnnotations: map[string]string{"owner": "team-a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := fake.NewServer(newDeployment("web", 1))
+			if _, err := saectl(t, s, tt.newCmd, tt.args...); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			deploy := getDeployment(t, s, "web")
+			if fmt.Sprint(deploy.Labels) != fmt.Sprint(tt.wantLabels) {
+				t.Errorf("expected labels %v, got %v", tt.wantLabels, deploy.Labels)
+			}
+			for key, value := range tt.wantAnnotations {
+				if deploy.Annotations[key] != value {
+					t.Errorf("expected annotations %v, got %v", tt.wantAnnotations, deploy.Annotations)
+				}
+			}
+		})
+	}
+}
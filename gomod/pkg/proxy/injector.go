@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+)
+
+// RequestInjectorFunc adapts a function to a RequestInjector.
+type RequestInjectorFunc func(request *requests.CommonRequest) error
+
+func (f RequestInjectorFunc) ApplyToRequest(request *requests.CommonRequest) error {
+	return f(request)
+}
+
+// ResponseInjectorFunc adapts a function to a ResponseInjector.
+type ResponseInjectorFunc func(response *http.Response) error
+
+func (f ResponseInjectorFunc) ApplyToResponse(response *http.Response) error {
+	return f(response)
+}
+
+// InputInjectorFunc edits the Kubernetes request inside the envelope, e.g. to add headers or rewrite the content.
+type InputInjectorFunc func(in *Input) error
+
+func (f InputInjectorFunc) ApplyToRequest(request *requests.CommonRequest) error {
+	in := new(Input)
+	if err := json.Unmarshal(request.GetContent(), in); err != nil {
+		return fmt.Errorf("fail to decode request envelope: %v", err)
+	}
+	if err := f(in); err != nil {
+		return err
+	}
+	content, err := in.json()
+	if err != nil {
+		return err
+	}
+	request.SetContent(content)
+	return nil
+}
+
+// APIVersionInjector calls another version of the VirtualServerProxy API than SAEYamlPopAPIVersion.
+type APIVersionInjector struct {
+	Version string
+}
+
+func (r APIVersionInjector) ApplyToRequest(request *requests.CommonRequest) error {
+	if len(r.Version) != 0 {
+		request.Version = r.Version
+	}
+	return nil
+}
+
+// EndpointInjector sends the envelope to another POP endpoint than the server of the Kubernetes request,
+// e.g. a VPC endpoint. An empty Scheme keeps the scheme of the server.
+type EndpointInjector struct {
+	Domain string
+	Scheme string
+}
+
+func (r EndpointInjector) ApplyToRequest(request *requests.CommonRequest) error {
+	if len(r.Domain) != 0 {
+		request.Domain = r.Domain
+	}
+	if len(r.Scheme) != 0 {
+		request.Scheme = r.Scheme
+	}
+	return nil
+}
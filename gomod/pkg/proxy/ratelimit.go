@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"context"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+const (
+	DefaultQPS   float32 = 20
+	DefaultBurst         = 40
+)
+
+// RateLimiter holds requests back to share a token bucket among all clients of a command,
+// unlike the limiters of client-go which are created per client.
+type RateLimiter struct {
+	Processor
+	Limiter flowcontrol.RateLimiter
+}
+
+var _ ContextProcessor = &RateLimiter{}
+
+func NewRateLimiter(processor Processor, qps float32, burst int) *RateLimiter {
+	return &RateLimiter{Processor: processor, Limiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst)}
+}
+
+func (r *RateLimiter) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	return r.ProcessCommonRequestWithContext(context.Background(), request)
+}
+
+// ProcessCommonRequestWithContext waits for a token, the wait ends early once ctx is done.
+func (r *RateLimiter) ProcessCommonRequestWithContext(ctx context.Context, request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	if err := r.Limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return ProcessWithContext(ctx, r.Processor, request)
+}
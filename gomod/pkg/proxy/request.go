@@ -7,9 +7,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+
+	"saectl/version"
 )
 
 const (
@@ -22,6 +26,13 @@ const (
 	SAEYamlDefaultMethod = "POST"
 )
 
+const (
+	// CommandHeader carries the invoked command, e.g. saectl create secret generic
+	CommandHeader = "Saectl-Command"
+	// SessionHeader carries an id shared by all requests of one invocation
+	SessionHeader = "Saectl-Session"
+)
+
 type MetaRequestInjector struct{}
 
 func (r MetaRequestInjector) ApplyToRequest(request *requests.CommonRequest) error {
@@ -33,7 +44,10 @@ func (r MetaRequestInjector) ApplyToRequest(request *requests.CommonRequest) err
 	request.ServiceCode = SAEPopServiceCode
 	request.EndpointType = "openAPI"
 	request.Method = SAEYamlDefaultMethod
+	// the envelope is JSON, the content type of the Kubernetes request travels inside it
 	request.SetContentType("application/json")
+	request.AppendUserAgent("saectl", version.SaeCtlVersion)
+	request.AppendUserAgent("git", version.GitRevision)
 	return nil
 }
 
@@ -65,6 +79,8 @@ type ResponseInjector interface {
 
 type HttpRequestInjector struct {
 	*http.Request
+	// Compression tells whether the server accepts base64 encoded request bodies, it may be nil
+	Compression *Compression
 }
 
 func (r HttpRequestInjector) ApplyToRequest(request *requests.CommonRequest) error {
@@ -73,16 +89,24 @@ func (r HttpRequestInjector) ApplyToRequest(request *requests.CommonRequest) err
 		reqPath += "?" + query.Encode()
 	}
 	request.Domain = r.URL.Host
-	r.Header.Set("User-Agent", "saectl")
-	body := &input{
+	appendUserAgent(request, r.Header)
+	// an explicit scheme of the server wins, e.g. http for a local fake
+	if len(r.URL.Scheme) != 0 {
+		request.Scheme = r.URL.Scheme
+	}
+	body := &Input{
 		Path:        reqPath,
 		Method:      r.Method,
-		ContentType: "application/json",
+		ContentType: r.Header.Get("Content-Type"),
+		Accept:      r.Header.Get("Accept"),
 		Header:      r.Header,
 	}
+	if len(body.ContentType) == 0 {
+		body.ContentType = "application/json"
+	}
 	if r.Body != nil {
 		data, _ := io.ReadAll(r.Body)
-		body.Content = string(data)
+		r.Compression.setContent(body, data)
 	}
 	content, err := body.json()
 	if err != nil {
@@ -92,6 +116,25 @@ func (r HttpRequestInjector) ApplyToRequest(request *requests.CommonRequest) err
 	return nil
 }
 
+// appendUserAgent tags the POP request like the Kubernetes request, with the command, the session and
+// the caller tag following the saectl User-Agent, so SAE tells the requests of saectl apart as well.
+func appendUserAgent(request *requests.CommonRequest, header http.Header) {
+	if command := header.Get(CommandHeader); len(command) != 0 {
+		request.AppendUserAgent("command", userAgentValue(command))
+	}
+	if session := header.Get(SessionHeader); len(session) != 0 {
+		request.AppendUserAgent("session", userAgentValue(session))
+	}
+	if suffix := strings.TrimPrefix(header.Get("User-Agent"), version.UserAgent()); suffix != header.Get("User-Agent") && len(strings.TrimSpace(suffix)) != 0 {
+		request.AppendUserAgent("caller", userAgentValue(suffix))
+	}
+}
+
+// userAgentValue keeps value a single product token of the User-Agent, e.g. "saectl get" becomes "saectl.get".
+func userAgentValue(value string) string {
+	return strings.Join(strings.Fields(value), ".")
+}
+
 func (r HttpRequestInjector) ApplyToResponse(response *http.Response) error {
 	response.ProtoMinor = r.ProtoMinor
 	response.Proto = r.Proto
@@ -102,33 +145,75 @@ func (r HttpRequestInjector) ApplyToResponse(response *http.Response) error {
 
 type HttpResponseInjector struct {
 	*responses.CommonResponse
+	// Compression learns from the response whether the server accepts compressed requests, it may be nil
+	Compression *Compression
 }
 
+// ApplyToResponse unwraps the Kubernetes response, failures become a Status carrying the RequestId.
 func (r HttpResponseInjector) ApplyToResponse(response *http.Response) error {
-	out := new(output)
+	method := requestMethod(response)
+	out := new(Output)
 	if err := out.unmarshal(r.GetHttpContentBytes()); err != nil {
-		return fmt.Errorf("fail to decode responses from sae, response: %s", string(r.GetHttpContentBytes()))
+		requestId := firstHeader(r.GetHttpHeaders(), "X-Acs-Request-Id")
+		return applyStatus(response, newStatus(method, http.StatusBadGateway,
+			fmt.Sprintf("fail to decode responses from sae, response: %s", string(r.GetHttpContentBytes())), requestId))
+	}
+	r.Compression.learn(out)
+	var trace *RequestTrace
+	if response.Request != nil {
+		if trace = RequestTraceFrom(response.Request.Context()); trace != nil {
+			trace.RequestId = out.RequestId
+		}
 	}
 	response.Header = out.Header
 	response.StatusCode = out.Code
-	data, err := base64.StdEncoding.DecodeString(out.Body)
+	data, err := out.DecodeBody()
 	if err != nil {
-		return err
+		return applyStatus(response, newStatus(method, http.StatusBadGateway,
+			fmt.Sprintf("fail to decode response body from sae: %v", err), out.RequestId))
+	}
+	if trace != nil && len(out.ContentEncoding) != 0 {
+		trace.Saved += base64.StdEncoding.EncodedLen(len(data)) - len(out.Body)
+	}
+	if status := statusForOutput(method, out, data); status != nil {
+		return applyStatus(response, status)
 	}
 	response.Body = io.NopCloser(bytes.NewReader(data))
 	response.ContentLength = int64(len(data))
 	return nil
 }
 
-type input struct {
-	Path        string              `json:"path"`
-	Method      string              `json:"method"`
-	ContentType string              `json:"contentType"`
-	Content     string              `json:"content"`
-	Header      map[string][]string `json:"header,omitempty"`
+// ServerErrorInjector turns an error of the POP gateway into a Status response, e.g. 403 for a RAM denial.
+type ServerErrorInjector struct {
+	*sdkerrors.ServerError
+}
+
+func (r ServerErrorInjector) ApplyToResponse(response *http.Response) error {
+	return applyStatus(response, statusForServerError(requestMethod(response), r.ServerError))
+}
+
+func requestMethod(response *http.Response) string {
+	if response.Request == nil {
+		return ""
+	}
+	return response.Request.Method
+}
+
+// Input is the envelope of a Kubernetes request sent to VirtualServerProxy.
+// ContentType and Accept are the headers of the Kubernetes request, e.g. a patch type or protobuf,
+// binary contents are base64 encoded and large ones compressed, see Compression.
+type Input struct {
+	Path            string              `json:"path"`
+	Method          string              `json:"method"`
+	ContentType     string              `json:"contentType"`
+	Accept          string              `json:"accept,omitempty"`
+	Content         string              `json:"content"`
+	ContentEncoding string              `json:"contentEncoding,omitempty"`
+	AcceptEncoding  string              `json:"acceptEncoding,omitempty"`
+	Header          map[string][]string `json:"header,omitempty"`
 }
 
-func (in *input) json() ([]byte, error) {
+func (in *Input) json() ([]byte, error) {
 	bt, err := json.Marshal(in)
 	if err != nil {
 		return nil, err
@@ -136,15 +221,19 @@ func (in *input) json() ([]byte, error) {
 	return bt, nil
 }
 
-type output struct {
-	RequestId string              `json:"requestId"`
-	Code      int                 `json:"code"`
-	Error     string              `json:"error,omitempty"`
-	Body      string              `json:"body,omitempty"`
-	Header    map[string][]string `json:"header,omitempty"`
+// Output is the envelope of a Kubernetes response, Body is base64 encoded.
+// AcceptEncoding advertises the encodings the server accepts for the content of requests.
+type Output struct {
+	RequestId       string              `json:"requestId"`
+	Code            int                 `json:"code"`
+	Error           string              `json:"error,omitempty"`
+	Body            string              `json:"body,omitempty"`
+	ContentEncoding string              `json:"contentEncoding,omitempty"`
+	AcceptEncoding  string              `json:"acceptEncoding,omitempty"`
+	Header          map[string][]string `json:"header,omitempty"`
 }
 
-func (out *output) unmarshal(data []byte) error {
+func (out *Output) unmarshal(data []byte) error {
 	if err := json.Unmarshal(data, out); err != nil {
 		return err
 	}
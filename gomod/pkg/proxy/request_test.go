@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+
+	"saectl/version"
+)
+
+func TestRequestUserAgent(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   map[string]string
+	}{
+		{
+			name:   "without command headers",
+			header: http.Header{"User-Agent": {version.UserAgent()}},
+			want:   map[string]string{"saectl": version.SaeCtlVersion, "git": version.GitRevision},
+		},
+		{
+			name: "command, session and caller tag",
+			header: http.Header{
+				"User-Agent":  {version.UserAgent() + " my-ci/1.2 (build 7)"},
+				CommandHeader: {"saectl create secret generic"},
+				SessionHeader: {"0b5a0e5c-9b5e-4b8a-a7a3-6f4c3b1a2d9e"},
+			},
+			want: map[string]string{
+				"saectl":  version.SaeCtlVersion,
+				"git":     version.GitRevision,
+				"command": "saectl.create.secret.generic",
+				"session": "0b5a0e5c-9b5e-4b8a-a7a3-6f4c3b1a2d9e",
+				"caller":  "my-ci/1.2.(build.7)",
+			},
+		},
+		{
+			name:   "foreign user agent",
+			header: http.Header{"User-Agent": {"Go-http-client/1.1"}},
+			want:   map[string]string{"saectl": version.SaeCtlVersion, "git": version.GitRevision},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "https://sae.cn-hangzhou.aliyuncs.com/api/v1/namespaces/default/pods", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = tt.header
+			popReq := requests.NewCommonRequest()
+			if err = warpRequest(popReq, MetaRequestInjector{}, HttpRequestInjector{Request: req}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := popReq.GetUserAgent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
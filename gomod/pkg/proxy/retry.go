@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultMaxRetries      = 3
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultRetryMaxBackoff = 10 * time.Second
+)
+
+// RetryPolicy decides whether and when a failed POP request is sent again.
+//
+// Throttled requests were rejected before reaching SAE, so they are retried for any verb.
+// Other failures may happen after the request took effect, they are only retried for
+// idempotent verbs unless NonIdempotent is set.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retrying
+	MaxRetries int
+	// Backoff is the delay before the first retry, it doubles with every retry up to MaxBackoff.
+	// A longer Retry-After of the server is waited for unless it exceeds the deadline of the request.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// ThrottlingCodes and RetryableCodes are POP error codes, matched as prefixes.
+	// Timeouts and connection errors are retryable, the SDK returns them as they are as its AutoRetry is off.
+	ThrottlingCodes []string
+	RetryableCodes  []string
+	// RetryableStatuses are HTTP statuses of the POP gateway or of the Kubernetes response
+	RetryableStatuses sets.Int
+	NonIdempotent     bool
+}
+
+func NewDefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:        DefaultMaxRetries,
+		Backoff:           DefaultRetryBackoff,
+		MaxBackoff:        DefaultRetryMaxBackoff,
+		ThrottlingCodes:   []string{"Throttling"},
+		RetryableCodes:    []string{"ServiceUnavailable", "InternalError"},
+		RetryableStatuses: sets.NewInt(http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout),
+	}
+}
+
+// idempotentMethods can be sent again without changing the outcome.
+var idempotentMethods = sets.NewString(http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete)
+
+// failure describes why an attempt failed, an empty reason means it succeeded or must not be retried.
+type failure struct {
+	reason     string
+	throttled  bool
+	requestId  string
+	retryAfter time.Duration
+}
+
+func (p *RetryPolicy) classify(response *responses.CommonResponse, err error) failure {
+	if err != nil {
+		switch e := err.(type) {
+		case *sdkerrors.ServerError:
+			f := failure{requestId: e.RequestId(), reason: fmt.Sprintf("%s (HTTP %d)", e.ErrorCode(), e.HttpStatus())}
+			if response != nil {
+				f.retryAfter = parseRetryAfter(firstHeader(response.GetHttpHeaders(), "Retry-After"))
+			}
+			switch {
+			case hasPrefix(e.ErrorCode(), p.ThrottlingCodes) || e.HttpStatus() == http.StatusTooManyRequests:
+				f.throttled = true
+			case hasPrefix(e.ErrorCode(), p.RetryableCodes) || p.RetryableStatuses.Has(e.HttpStatus()):
+			default:
+				f.reason = ""
+			}
+			return f
+		case *sdkerrors.ClientError:
+			if hasPrefix(e.ErrorCode(), p.RetryableCodes) {
+				return failure{reason: e.ErrorCode()}
+			}
+			return failure{}
+		case *url.Error, net.Error:
+			return failure{reason: err.Error()}
+		}
+		return failure{}
+	}
+
+	// the gateway answered, the Kubernetes response itself may still ask to retry
+	out := new(Output)
+	if response == nil || out.unmarshal(response.GetHttpContentBytes()) != nil {
+		return failure{}
+	}
+	f := failure{requestId: out.RequestId, reason: fmt.Sprintf("HTTP %d", out.Code)}
+	f.retryAfter = parseRetryAfter(firstHeader(out.Header, "Retry-After"))
+	switch {
+	case out.Code == http.StatusTooManyRequests:
+		f.throttled = true
+	case p.RetryableStatuses.Has(out.Code):
+	default:
+		f.reason = ""
+	}
+	return f
+}
+
+func hasPrefix(code string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(code, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstHeader(header map[string][]string, key string) string {
+	if values := http.Header(header).Values(key); len(values) != 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// parseRetryAfter accepts both forms of Retry-After, delay seconds and an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// delay is the wait before the next retry, MaxBackoff caps the backoff only, the server may ask to wait longer.
+func (p *RetryPolicy) delay(backoff *wait.Backoff, f failure) time.Duration {
+	delay := backoff.Step()
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if f.retryAfter > delay {
+		delay = f.retryAfter
+	}
+	return delay
+}
+
+// Retrier sends a request again according to its policy.
+type Retrier struct {
+	Processor
+	Policy *RetryPolicy
+}
+
+var _ ContextProcessor = &Retrier{}
+
+func NewRetrier(processor Processor, policy *RetryPolicy) *Retrier {
+	return &Retrier{Processor: processor, Policy: policy}
+}
+
+func (r *Retrier) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	return r.ProcessCommonRequestWithContext(context.Background(), request)
+}
+
+// ProcessCommonRequestWithContext gives up retrying once ctx is done.
+func (r *Retrier) ProcessCommonRequestWithContext(ctx context.Context, request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	in := new(Input)
+	_ = json.Unmarshal(request.GetContent(), in)
+	idempotent := idempotentMethods.Has(in.Method) || r.Policy.NonIdempotent
+
+	backoff := wait.Backoff{
+		Duration: r.Policy.Backoff,
+		Factor:   2,
+		Jitter:   0.5,
+		Steps:    r.Policy.MaxRetries + 1,
+		Cap:      r.Policy.MaxBackoff,
+	}
+	trace := RequestTraceFrom(ctx)
+	for attempt := 1; ; attempt++ {
+		if trace != nil {
+			trace.Attempts = attempt
+		}
+		response, err := ProcessWithContext(ctx, r.Processor, request)
+		f := r.Policy.classify(response, err)
+		if len(f.reason) == 0 || attempt > r.Policy.MaxRetries || !(f.throttled || idempotent) || ctx.Err() != nil {
+			return response, err
+		}
+		delay := r.Policy.delay(&backoff, f)
+		if deadline, ok := ctx.Deadline(); ok && delay > time.Until(deadline) {
+			klog.V(4).Infof("Giving up %s %s after attempt %d failed: %s, retrying in %s exceeds the request timeout, RequestId: %s",
+				in.Method, in.Path, attempt, f.reason, delay, f.requestId)
+			return response, err
+		}
+		klog.V(4).Infof("Retrying %s %s in %s after attempt %d of %d failed: %s, RequestId: %s",
+			in.Method, in.Path, delay, attempt, r.Policy.MaxRetries+1, f.reason, f.requestId)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// popResponse is what the SDK returns for a response of the POP gateway, a server error for a failed status.
+func popResponse(status int, content string, header http.Header) (*responses.CommonResponse, error) {
+	if header == nil {
+		header = http.Header{}
+	}
+	response := responses.NewCommonResponse()
+	err := responses.Unmarshal(response, &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(content)),
+	}, "JSON")
+	return response, err
+}
+
+type attempt struct {
+	response *responses.CommonResponse
+	err      error
+}
+
+// scriptedProcessor answers with its attempts in order and repeats the last one.
+type scriptedProcessor struct {
+	attempts []attempt
+	calls    int
+}
+
+func (p *scriptedProcessor) ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	a := p.attempts[len(p.attempts)-1]
+	if p.calls < len(p.attempts) {
+		a = p.attempts[p.calls]
+	}
+	p.calls++
+	return a.response, a.err
+}
+
+func newAttempt(status int, content string, header http.Header) attempt {
+	response, err := popResponse(status, content, header)
+	return attempt{response: response, err: err}
+}
+
+var (
+	succeeded   = newAttempt(http.StatusOK, `{"requestId":"ok","code":200,"body":"e30="}`, nil)
+	throttled   = newAttempt(http.StatusServiceUnavailable, `{"RequestId":"throttled","Code":"Throttling.User","Message":"too many requests"}`, nil)
+	unavailable = newAttempt(http.StatusServiceUnavailable, `{"RequestId":"unavailable","Code":"ServiceUnavailable","Message":"down"}`, nil)
+	invalid     = newAttempt(http.StatusBadRequest, `{"RequestId":"invalid","Code":"InvalidParameter","Message":"bad"}`, nil)
+	timeout     = attempt{err: &url.Error{Op: "Post", URL: "https://sae.cn-hangzhou.aliyuncs.com", Err: context.DeadlineExceeded}}
+)
+
+func TestRetryPolicyClassify(t *testing.T) {
+	tests := []struct {
+		name           string
+		attempt        attempt
+		wantRetry      bool
+		wantThrottled  bool
+		wantRequestId  string
+		wantRetryAfter time.Duration
+	}{
+		{name: "success", attempt: succeeded},
+		{name: "throttled", attempt: throttled, wantRetry: true, wantThrottled: true, wantRequestId: "throttled"},
+		{
+			name:          "too many requests",
+			attempt:       newAttempt(http.StatusTooManyRequests, `{"RequestId":"429","Code":"Unknown"}`, nil),
+			wantRetry:     true,
+			wantThrottled: true,
+			wantRequestId: "429",
+		},
+		{name: "retryable code", attempt: unavailable, wantRetry: true, wantRequestId: "unavailable"},
+		{
+			name:          "retryable status",
+			attempt:       newAttempt(http.StatusBadGateway, `{"RequestId":"502","Code":"Unknown"}`, nil),
+			wantRetry:     true,
+			wantRequestId: "502",
+		},
+		{name: "client fault", attempt: invalid, wantRequestId: "invalid"},
+		{name: "timeout", attempt: timeout, wantRetry: true},
+		{name: "client error", attempt: attempt{err: sdkerrors.NewClientError("SDK.InvalidRegionId", "no region", nil)}},
+		{
+			name:           "Retry-After of the gateway",
+			attempt:        newAttempt(http.StatusServiceUnavailable, `{"RequestId":"after","Code":"Throttling"}`, http.Header{"Retry-After": {"7"}}),
+			wantRetry:      true,
+			wantThrottled:  true,
+			wantRequestId:  "after",
+			wantRetryAfter: 7 * time.Second,
+		},
+		{
+			name:           "Kubernetes response asking to retry",
+			attempt:        newAttempt(http.StatusOK, `{"requestId":"k8s","code":503,"header":{"Retry-After":["2"]}}`, nil),
+			wantRetry:      true,
+			wantRequestId:  "k8s",
+			wantRetryAfter: 2 * time.Second,
+		},
+		{
+			name:          "Kubernetes response throttled",
+			attempt:       newAttempt(http.StatusOK, `{"requestId":"k8s","code":429}`, nil),
+			wantRetry:     true,
+			wantThrottled: true,
+			wantRequestId: "k8s",
+		},
+		{name: "Kubernetes conflict", attempt: newAttempt(http.StatusOK, `{"requestId":"k8s","code":409}`, nil), wantRequestId: "k8s"},
+	}
+	policy := NewDefaultRetryPolicy()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := policy.classify(tt.attempt.response, tt.attempt.err)
+			if (len(f.reason) != 0) != tt.wantRetry {
+				t.Errorf("expected retry %v, got reason %q", tt.wantRetry, f.reason)
+			}
+			if f.throttled != tt.wantThrottled {
+				t.Errorf("expected throttled %v, got %v", tt.wantThrottled, f.throttled)
+			}
+			if tt.wantRetry && f.requestId != tt.wantRequestId {
+				t.Errorf("expected RequestId %q, got %q", tt.wantRequestId, f.requestId)
+			}
+			if f.retryAfter != tt.wantRetryAfter {
+				t.Errorf("expected Retry-After %v, got %v", tt.wantRetryAfter, f.retryAfter)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		min, max   time.Duration
+	}{
+		{name: "backoff capped", min: 2 * time.Second, max: 2 * time.Second},
+		{name: "longer Retry-After", retryAfter: 5 * time.Second, min: 5 * time.Second, max: 5 * time.Second},
+		{name: "shorter Retry-After", retryAfter: time.Second, min: 2 * time.Second, max: 2 * time.Second},
+	}
+	policy := &RetryPolicy{MaxBackoff: 2 * time.Second}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the first steps of the jittered backoff would exceed MaxBackoff
+			backoff := &wait.Backoff{Duration: 8 * time.Second, Factor: 2, Jitter: 0.5, Steps: 3, Cap: policy.MaxBackoff}
+			for i := 0; i < 3; i++ {
+				if delay := policy.delay(backoff, failure{retryAfter: tt.retryAfter}); delay < tt.min || delay > tt.max {
+					t.Errorf("expected a delay between %v and %v, got %v", tt.min, tt.max, delay)
+				}
+			}
+		})
+	}
+}
+
+func TestRetrier(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		nonIdempotent bool
+		timeout       time.Duration
+		attempts      []attempt
+		wantCalls     int
+		wantErr       bool
+	}{
+		{name: "success", method: http.MethodGet, attempts: []attempt{succeeded}, wantCalls: 1},
+		{name: "idempotent retried", method: http.MethodGet, attempts: []attempt{unavailable, timeout, succeeded}, wantCalls: 3},
+		{name: "non-idempotent not retried", method: http.MethodPost, attempts: []attempt{unavailable, succeeded}, wantCalls: 1, wantErr: true},
+		{name: "non-idempotent retried when allowed", method: http.MethodPost, nonIdempotent: true, attempts: []attempt{unavailable, succeeded}, wantCalls: 2},
+		{name: "throttled retried for any verb", method: http.MethodPatch, attempts: []attempt{throttled, succeeded}, wantCalls: 2},
+		{name: "client fault not retried", method: http.MethodGet, attempts: []attempt{invalid, succeeded}, wantCalls: 1, wantErr: true},
+		{name: "gives up after max retries", method: http.MethodGet, attempts: []attempt{unavailable}, wantCalls: 3, wantErr: true},
+		{
+			name:      "Retry-After beyond the deadline",
+			method:    http.MethodGet,
+			timeout:   time.Second,
+			attempts:  []attempt{newAttempt(http.StatusServiceUnavailable, `{"RequestId":"after","Code":"Throttling"}`, http.Header{"Retry-After": {"30"}}), succeeded},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processor := &scriptedProcessor{attempts: tt.attempts}
+			policy := NewDefaultRetryPolicy()
+			policy.MaxRetries = 2
+			policy.Backoff = time.Millisecond
+			policy.MaxBackoff = time.Millisecond
+			policy.NonIdempotent = tt.nonIdempotent
+			request := requests.NewCommonRequest()
+			request.SetContent([]byte(`{"path":"/api/v1/namespaces/default/pods","method":"` + tt.method + `"}`))
+
+			ctx := context.Background()
+			if tt.timeout != 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			start := time.Now()
+			_, err := NewRetrier(processor, policy).ProcessCommonRequestWithContext(ctx, request)
+			if processor.calls != tt.wantCalls {
+				t.Errorf("expected %d attempts, got %d", tt.wantCalls, processor.calls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.timeout != 0 && time.Since(start) >= tt.timeout {
+				t.Errorf("expected to give up at once, took %v", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{value: ""},
+		{value: "3", min: 3 * time.Second, max: 3 * time.Second},
+		{value: "-1"},
+		{value: "soon"},
+		{value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 58 * time.Second, max: time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := parseRetryAfter(tt.value); got < tt.min || got > tt.max {
+				t.Errorf("expected between %v and %v, got %v", tt.min, tt.max, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// CauseTypeRequestId is the type of the cause carrying the POP RequestId in the details of a Status,
+// support tickets should quote it.
+const CauseTypeRequestId metav1.CauseType = "RequestId"
+
+// popErrorCodes maps error codes of the POP gateway, matched as prefixes, to the status and hint surfaced to the user.
+var popErrorCodes = []struct {
+	prefix string
+	code   int
+	hint   string
+}{
+	{"InvalidAccessKeyId", http.StatusUnauthorized, "the access key is unknown or disabled, check the credential reported by `saectl config whoami`"},
+	{"SignatureDoesNotMatch", http.StatusUnauthorized, "the access key secret does not match the access key id, check the credential reported by `saectl config whoami`"},
+	{"InvalidSecurityToken", http.StatusUnauthorized, "the STS token is invalid or expired, refresh it or run `saectl config logout` to drop cached sessions"},
+	{"IncompleteSignature", http.StatusUnauthorized, "the request signature was rejected, check the credential reported by `saectl config whoami`"},
+	{"Forbidden", http.StatusForbidden, "the RAM identity is not allowed to call SAE, grant it an SAE policy such as AliyunSAEFullAccess"},
+	{"NoPermission", http.StatusForbidden, "the RAM identity is not allowed to call SAE, grant it an SAE policy such as AliyunSAEFullAccess"},
+	{"Throttling", http.StatusTooManyRequests, "the request was throttled by SAE, retry later or raise --max-retries"},
+}
+
+// statusForServerError converts an error returned by the POP gateway itself, i.e. before the request reached Kubernetes.
+func statusForServerError(method string, err *sdkerrors.ServerError) *metav1.Status {
+	code, message := err.HttpStatus(), fmt.Sprintf("%s: %s", err.ErrorCode(), strings.TrimSuffix(err.Message(), "."))
+	for _, c := range popErrorCodes {
+		if strings.HasPrefix(err.ErrorCode(), c.prefix) {
+			code, message = c.code, fmt.Sprintf("%s, %s", message, c.hint)
+			break
+		}
+	}
+	if code < http.StatusBadRequest {
+		code = http.StatusInternalServerError
+	}
+	return newStatus(method, code, message, err.RequestId())
+}
+
+// statusForOutput returns the Status of a failed envelope, or nil if the Kubernetes response can be passed on as is.
+// A Status sent by Kubernetes is kept and only gains the RequestId.
+func statusForOutput(method string, out *Output, body []byte) *metav1.Status {
+	code := out.Code
+	if code == 0 && len(out.Error) != 0 {
+		code = http.StatusInternalServerError
+	}
+	if code < http.StatusBadRequest {
+		return nil
+	}
+	if contentType := firstHeader(out.Header, "Content-Type"); strings.Contains(contentType, "protobuf") {
+		return nil
+	}
+	status := new(metav1.Status)
+	if err := json.Unmarshal(body, status); err == nil && status.Kind == "Status" {
+		addRequestId(status, out.RequestId)
+		return status
+	}
+	message := out.Error
+	if len(message) == 0 {
+		message = strings.TrimSpace(string(body))
+	}
+	return newStatus(method, code, message, out.RequestId)
+}
+
+func newStatus(method string, code int, message, requestId string) *metav1.Status {
+	status := apierrors.NewGenericServerResponse(code, method, schema.GroupResource{}, "", message, 0, false).ErrStatus
+	if len(message) != 0 {
+		status.Message = message
+	}
+	status.APIVersion, status.Kind = "v1", "Status"
+	addRequestId(&status, requestId)
+	return &status
+}
+
+func addRequestId(status *metav1.Status, requestId string) {
+	if len(requestId) == 0 {
+		return
+	}
+	if status.Details == nil {
+		status.Details = &metav1.StatusDetails{}
+	}
+	status.Details.Causes = append(status.Details.Causes, metav1.StatusCause{Type: CauseTypeRequestId, Message: requestId})
+	status.Message = fmt.Sprintf("%s (RequestId: %s)", status.Message, requestId)
+}
+
+// applyStatus replaces the body of response with status.
+func applyStatus(response *http.Response, status *metav1.Status) error {
+	data, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if response.Header == nil {
+		response.Header = http.Header{}
+	}
+	response.Header.Set("Content-Type", "application/json")
+	response.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	response.StatusCode = int(status.Code)
+	response.Status = fmt.Sprintf("%d %s", status.Code, http.StatusText(int(status.Code)))
+	response.Body = io.NopCloser(bytes.NewReader(data))
+	response.ContentLength = int64(len(data))
+	return nil
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// envelope is the answer of the gateway carrying a Kubernetes response.
+func envelope(t *testing.T, out Output, body string) attempt {
+	t.Helper()
+	out.Body = base64.StdEncoding.EncodeToString([]byte(body))
+	content, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAttempt(http.StatusOK, string(content), nil)
+}
+
+// roundTrip sends a Kubernetes request through a transport answering with a.
+func roundTrip(t *testing.T, path string, a attempt) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "https://sae.cn-hangzhou.aliyuncs.com"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTransport(http.DefaultTransport, &scriptedProcessor{attempts: []attempt{a}}).RoundTrip(req)
+}
+
+func TestTransportStatus(t *testing.T) {
+	const pods = "/api/v1/namespaces/default/pods"
+	notFound := `{"kind":"Status","apiVersion":"v1","status":"Failure","message":"pods \"web\" not found","reason":"NotFound","code":404}`
+	tests := []struct {
+		name    string
+		attempt attempt
+		// wantCode and wantReason describe the Status of the response, an empty wantReason means the body is passed on
+		wantCode      int
+		wantReason    metav1.StatusReason
+		wantMessage   string
+		wantRequestId string
+	}{
+		{
+			name:          "unknown access key",
+			attempt:       newAttempt(http.StatusNotFound, `{"RequestId":"pop-1","Code":"InvalidAccessKeyId.NotFound","Message":"Specified access key is not found."}`, nil),
+			wantCode:      http.StatusUnauthorized,
+			wantReason:    metav1.StatusReasonUnauthorized,
+			wantMessage:   "InvalidAccessKeyId.NotFound: Specified access key is not found, the access key is unknown or disabled",
+			wantRequestId: "pop-1",
+		},
+		{
+			name:          "RAM denial",
+			attempt:       newAttempt(http.StatusForbidden, `{"RequestId":"pop-2","Code":"Forbidden.RAM","Message":"User not authorized."}`, nil),
+			wantCode:      http.StatusForbidden,
+			wantReason:    metav1.StatusReasonForbidden,
+			wantMessage:   "grant it an SAE policy such as AliyunSAEFullAccess",
+			wantRequestId: "pop-2",
+		},
+		{
+			name:          "throttled",
+			attempt:       newAttempt(http.StatusServiceUnavailable, `{"RequestId":"pop-3","Code":"Throttling.User","Message":"Request was denied due to user flow control."}`, nil),
+			wantCode:      http.StatusTooManyRequests,
+			wantReason:    metav1.StatusReasonTooManyRequests,
+			wantMessage:   "retry later or raise --max-retries",
+			wantRequestId: "pop-3",
+		},
+		{
+			name:          "unknown POP error",
+			attempt:       invalid,
+			wantCode:      http.StatusBadRequest,
+			wantReason:    metav1.StatusReasonBadRequest,
+			wantMessage:   "InvalidParameter: bad (RequestId: invalid)",
+			wantRequestId: "invalid",
+		},
+		{
+			name:          "Kubernetes Status",
+			attempt:       envelope(t, Output{RequestId: "k8s-1", Code: http.StatusNotFound}, notFound),
+			wantCode:      http.StatusNotFound,
+			wantReason:    metav1.StatusReasonNotFound,
+			wantMessage:   `pods "web" not found (RequestId: k8s-1)`,
+			wantRequestId: "k8s-1",
+		},
+		{
+			name:          "Kubernetes failure without Status",
+			attempt:       envelope(t, Output{RequestId: "k8s-2", Code: http.StatusBadGateway}, "upstream connect error\n"),
+			wantCode:      http.StatusBadGateway,
+			wantReason:    metav1.StatusReasonInternalError,
+			wantMessage:   "upstream connect error (RequestId: k8s-2)",
+			wantRequestId: "k8s-2",
+		},
+		{
+			name:          "envelope error",
+			attempt:       envelope(t, Output{RequestId: "k8s-3", Error: "cluster is not ready"}, ""),
+			wantCode:      http.StatusInternalServerError,
+			wantReason:    metav1.StatusReasonInternalError,
+			wantMessage:   "cluster is not ready (RequestId: k8s-3)",
+			wantRequestId: "k8s-3",
+		},
+		{
+			name:          "undecodable envelope",
+			attempt:       newAttempt(http.StatusOK, `<html>gateway</html>`, http.Header{"X-Acs-Request-Id": {"pop-4"}}),
+			wantCode:      http.StatusBadGateway,
+			wantReason:    metav1.StatusReasonInternalError,
+			wantMessage:   "fail to decode responses from sae",
+			wantRequestId: "pop-4",
+		},
+		{
+			name: "protobuf failure passed on",
+			attempt: envelope(t, Output{RequestId: "k8s-4", Code: http.StatusNotFound,
+				Header: map[string][]string{"Content-Type": {"application/vnd.kubernetes.protobuf"}}}, "k8s\x00"),
+			wantCode: http.StatusNotFound,
+		},
+		{name: "success passed on", attempt: envelope(t, Output{RequestId: "k8s-5", Code: http.StatusOK}, `{"kind":"PodList"}`), wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := roundTrip(t, pods, tt.attempt)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if response.StatusCode != tt.wantCode {
+				t.Errorf("expected status %d, got %d", tt.wantCode, response.StatusCode)
+			}
+			data, err := io.ReadAll(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.wantReason) == 0 {
+				if strings.Contains(string(data), `"kind":"Status"`) {
+					t.Errorf("expected the body to be passed on, got %s", data)
+				}
+				return
+			}
+			status := new(metav1.Status)
+			if err = json.Unmarshal(data, status); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if status.Kind != "Status" || int(status.Code) != tt.wantCode || status.Reason != tt.wantReason {
+				t.Errorf("expected a Status %d %s, got %s", tt.wantCode, tt.wantReason, data)
+			}
+			if !strings.Contains(status.Message, tt.wantMessage) {
+				t.Errorf("expected the message to contain %q, got %q", tt.wantMessage, status.Message)
+			}
+			if !strings.Contains(status.Message, "(RequestId: "+tt.wantRequestId+")") {
+				t.Errorf("expected the message to quote RequestId %s, got %q", tt.wantRequestId, status.Message)
+			}
+			if status.Details == nil || len(status.Details.Causes) == 0 ||
+				status.Details.Causes[len(status.Details.Causes)-1] != (metav1.StatusCause{Type: CauseTypeRequestId, Message: tt.wantRequestId}) {
+				t.Errorf("expected a %s cause %s, got %+v", CauseTypeRequestId, tt.wantRequestId, status.Details)
+			}
+		})
+	}
+}
+
+// TestTransportDiscoveryDenied keeps denials of the discovery root paths errors, so discovery does not take them for an empty server.
+func TestTransportDiscoveryDenied(t *testing.T) {
+	denied := newAttempt(http.StatusForbidden, `{"RequestId":"pop-5","Code":"Forbidden.RAM","Message":"User not authorized."}`, nil)
+	for _, path := range []string{"/api", "/apis"} {
+		t.Run(path, func(t *testing.T) {
+			response, err := roundTrip(t, path, denied)
+			if err == nil {
+				t.Fatalf("expected an error, got status %d", response.StatusCode)
+			}
+			if !strings.Contains(err.Error(), "RequestId: pop-5") {
+				t.Errorf("expected the error to quote the RequestId, got %v", err)
+			}
+		})
+	}
+}
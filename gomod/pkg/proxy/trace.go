@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// TraceFormat is the output format of a Tracer.
+type TraceFormat string
+
+const (
+	TraceText TraceFormat = "text"
+	// TraceJSON writes one JSON object per line, requests have kind "request" and the summary kind "summary"
+	TraceJSON TraceFormat = "json"
+
+	// slowestRequests is the number of requests listed by the summary
+	slowestRequests = 5
+	traceLineFormat = "%-12s %-6s %-6s %8s %9s %9s %9s %-5s %s"
+)
+
+// RequestTrace describes one Kubernetes request, the transport fills in what only it knows.
+type RequestTrace struct {
+	Start  time.Time `json:"start"`
+	Verb   string    `json:"verb"`
+	Path   string    `json:"path"`
+	Status int       `json:"status,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	// RequestId is the POP RequestId of the last attempt
+	RequestId string `json:"requestId,omitempty"`
+	// RequestSize and ResponseSize are the sizes of the POP envelopes in bytes
+	RequestSize  int `json:"requestSize"`
+	ResponseSize int `json:"responseSize"`
+	// Saved is the number of envelope bytes saved by compression in both directions
+	Saved    int           `json:"saved"`
+	Attempts int           `json:"attempts"`
+	Latency  time.Duration `json:"-"`
+}
+
+// traceRecord is the JSON form of a RequestTrace.
+type traceRecord struct {
+	Kind string `json:"kind,omitempty"`
+	*RequestTrace
+	LatencyMs float64 `json:"latencyMs"`
+}
+
+func newTraceRecord(kind string, trace *RequestTrace) *traceRecord {
+	return &traceRecord{Kind: kind, RequestTrace: trace, LatencyMs: milliseconds(trace.Latency)}
+}
+
+type traceKey struct{}
+
+// WithRequestTrace returns a context that makes the transport fill in trace.
+func WithRequestTrace(ctx context.Context, trace *RequestTrace) context.Context {
+	return context.WithValue(ctx, traceKey{}, trace)
+}
+
+// RequestTraceFrom returns the trace of a request, or nil if it is not traced.
+func RequestTraceFrom(ctx context.Context) *RequestTrace {
+	trace, _ := ctx.Value(traceKey{}).(*RequestTrace)
+	return trace
+}
+
+// Tracer writes a line per request as it completes and a summary on Flush.
+type Tracer struct {
+	out    io.Writer
+	format TraceFormat
+
+	lock   sync.Mutex
+	traces []*RequestTrace
+}
+
+func NewTracer(out io.Writer, format TraceFormat) (*Tracer, error) {
+	if format != TraceText && format != TraceJSON {
+		return nil, fmt.Errorf("unknown trace format %q, must be %s or %s", format, TraceText, TraceJSON)
+	}
+	return &Tracer{out: out, format: format}, nil
+}
+
+// WrapTransport traces the requests sent through rt, it is meant to wrap a Transport.
+func (t *Tracer) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{tracer: t, delegate: rt}
+}
+
+func (t *Tracer) record(trace *RequestTrace) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.traces = append(t.traces, trace)
+	if t.format == TraceJSON {
+		_ = t.writeJSON(newTraceRecord("request", trace))
+		return
+	}
+	if len(t.traces) == 1 {
+		fmt.Fprintf(t.out, traceLineFormat+"\n", "TIME", "VERB", "STATUS", "LATENCY", "SENT", "RECEIVED", "SAVED", "TRIES", "PATH")
+	}
+	status := fmt.Sprint(trace.Status)
+	if len(trace.Error) != 0 {
+		status = "ERR"
+	}
+	line := fmt.Sprintf(traceLineFormat,
+		trace.Start.Format("15:04:05.000"), trace.Verb, status, trace.Latency.Round(time.Millisecond),
+		formatBytes(trace.RequestSize), formatBytes(trace.ResponseSize), formatBytes(trace.Saved), fmt.Sprint(trace.Attempts), trace.Path)
+	if len(trace.RequestId) != 0 {
+		line += " RequestId=" + trace.RequestId
+	}
+	if len(trace.Error) != 0 {
+		line += " error=" + trace.Error
+	}
+	fmt.Fprintln(t.out, line)
+}
+
+// traceSummary aggregates the requests of one verb, or of all requests for the total.
+type traceSummary struct {
+	Verb         string  `json:"verb"`
+	Requests     int     `json:"requests"`
+	Errors       int     `json:"errors"`
+	Retries      int     `json:"retries"`
+	RequestSize  int     `json:"requestSize"`
+	ResponseSize int     `json:"responseSize"`
+	Saved        int     `json:"saved"`
+	TotalMs      float64 `json:"totalMs"`
+	MaxMs        float64 `json:"maxMs"`
+}
+
+func (s *traceSummary) add(trace *RequestTrace) {
+	s.Requests++
+	if len(trace.Error) != 0 || trace.Status >= http.StatusBadRequest {
+		s.Errors++
+	}
+	if trace.Attempts > 1 {
+		s.Retries += trace.Attempts - 1
+	}
+	s.RequestSize += trace.RequestSize
+	s.ResponseSize += trace.ResponseSize
+	s.Saved += trace.Saved
+	latency := milliseconds(trace.Latency)
+	s.TotalMs += latency
+	if latency > s.MaxMs {
+		s.MaxMs = latency
+	}
+}
+
+// Flush writes the summary of the requests traced so far.
+func (t *Tracer) Flush() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	byVerb := map[string]*traceSummary{}
+	total := &traceSummary{Verb: "TOTAL"}
+	for _, trace := range t.traces {
+		if byVerb[trace.Verb] == nil {
+			byVerb[trace.Verb] = &traceSummary{Verb: trace.Verb}
+		}
+		byVerb[trace.Verb].add(trace)
+		total.add(trace)
+	}
+	var rows []*traceSummary
+	for _, s := range byVerb {
+		rows = append(rows, s)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Verb < rows[j].Verb })
+	slowest := append([]*RequestTrace{}, t.traces...)
+	sort.SliceStable(slowest, func(i, j int) bool { return slowest[i].Latency > slowest[j].Latency })
+	if len(slowest) > slowestRequests {
+		slowest = slowest[:slowestRequests]
+	}
+
+	if t.format == TraceJSON {
+		records := make([]*traceRecord, 0, len(slowest))
+		for _, trace := range slowest {
+			records = append(records, newTraceRecord("", trace))
+		}
+		return t.writeJSON(struct {
+			Kind    string          `json:"kind"`
+			Verbs   []*traceSummary `json:"verbs"`
+			Total   *traceSummary   `json:"total"`
+			Slowest []*traceRecord  `json:"slowest"`
+		}{"summary", rows, total, records})
+	}
+	w := tabwriter.NewWriter(t.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\nVERB\tREQUESTS\tERRORS\tRETRIES\tSENT\tRECEIVED\tSAVED\tTOTAL\tMAX")
+	for _, s := range append(rows, total) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%.0fms\t%.0fms\n",
+			s.Verb, s.Requests, s.Errors, s.Retries, formatBytes(s.RequestSize), formatBytes(s.ResponseSize), formatBytes(s.Saved), s.TotalMs, s.MaxMs)
+	}
+	if len(slowest) != 0 {
+		fmt.Fprintln(w, "\nSLOWEST\tSTATUS\tREQUESTID\tPATH")
+		for _, trace := range slowest {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s %s\n", trace.Latency.Round(time.Millisecond), trace.Status, trace.RequestId, trace.Verb, trace.Path)
+		}
+	}
+	return w.Flush()
+}
+
+// writeJSON must be called with the lock held.
+func (t *Tracer) writeJSON(v interface{}) error {
+	return json.NewEncoder(t.out).Encode(v)
+}
+
+type tracingTransport struct {
+	tracer   *Tracer
+	delegate http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &RequestTrace{Start: time.Now(), Verb: req.Method, Path: req.URL.RequestURI()}
+	response, err := t.delegate.RoundTrip(req.WithContext(WithRequestTrace(req.Context(), trace)))
+	trace.Latency = time.Since(trace.Start)
+	if trace.Attempts == 0 {
+		trace.Attempts = 1
+	}
+	if err != nil {
+		trace.Error = err.Error()
+	} else {
+		trace.Status = response.StatusCode
+	}
+	t.tracer.record(trace)
+	return response, err
+}
+
+// CancelRequest is a no-op, requests are cancelled through their context.
+func (t *tracingTransport) CancelRequest(req *http.Request) {}
+
+func (t *tracingTransport) WrappedRoundTripper() http.RoundTripper {
+	return t.delegate
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func formatBytes(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
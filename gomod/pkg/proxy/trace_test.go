@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
+)
+
+// tracedTransport traces requests sent through a transport retrying with processor like a command does.
+func tracedTransport(tracer *Tracer, processor Processor) http.RoundTripper {
+	policy := NewDefaultRetryPolicy()
+	policy.Backoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+	return tracer.WrapTransport(NewTransport(http.DefaultTransport, NewRetrier(processor, policy)))
+}
+
+func sendTraced(t *testing.T, rt http.RoundTripper, method, path string) {
+	t.Helper()
+	req, err := http.NewRequest(method, "https://sae.cn-hangzhou.aliyuncs.com"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response, err := rt.RoundTrip(req); err == nil {
+		response.Body.Close()
+	}
+}
+
+// compressedEnvelope is an answer of a server that compressed body.
+func compressedEnvelope(t *testing.T, body []byte) attempt {
+	t.Helper()
+	out := &Output{RequestId: "gzip", Code: http.StatusOK}
+	if err := out.EncodeBody(&Input{AcceptEncoding: EncodingGzip}, body); err != nil {
+		t.Fatal(err)
+	}
+	content, err := json.Marshal(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newAttempt(http.StatusOK, string(content), nil)
+}
+
+func TestTracerRecord(t *testing.T) {
+	podList := `{"kind":"PodList","items":[` + strings.Repeat(`{"kind":"Pod"},`, 200) + `{"kind":"Pod"}]}`
+	tests := []struct {
+		name          string
+		method        string
+		attempts      []attempt
+		wantStatus    int
+		wantRequestId string
+		wantAttempts  int
+		wantError     bool
+		wantSaved     bool
+	}{
+		{name: "success", method: http.MethodGet, attempts: []attempt{succeeded}, wantStatus: http.StatusOK, wantRequestId: "ok", wantAttempts: 1},
+		{name: "retried", method: http.MethodGet, attempts: []attempt{unavailable, throttled, succeeded}, wantStatus: http.StatusOK, wantRequestId: "ok", wantAttempts: 3},
+		{name: "POP error", method: http.MethodPost, attempts: []attempt{invalid}, wantStatus: http.StatusBadRequest, wantRequestId: "invalid", wantAttempts: 1},
+		{
+			name:         "transport error",
+			method:       http.MethodGet,
+			attempts:     []attempt{{err: sdkerrors.NewClientError("SDK.InvalidRegionId", "no region", nil)}},
+			wantAttempts: 1,
+			wantError:    true,
+		},
+		{
+			name:          "compressed response",
+			method:        http.MethodGet,
+			attempts:      []attempt{compressedEnvelope(t, []byte(podList))},
+			wantStatus:    http.StatusOK,
+			wantRequestId: "gzip",
+			wantAttempts:  1,
+			wantSaved:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tracer, err := NewTracer(&buf, TraceJSON)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sendTraced(t, tracedTransport(tracer, &scriptedProcessor{attempts: tt.attempts}), tt.method, "/api/v1/namespaces/default/pods")
+			record := new(traceRecord)
+			if err = json.Unmarshal(buf.Bytes(), record); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if record.Kind != "request" || record.Verb != tt.method || record.Path != "/api/v1/namespaces/default/pods" {
+				t.Errorf("expected a request record of %s, got %s", tt.method, buf.String())
+			}
+			if record.Status != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, record.Status)
+			}
+			if record.RequestId != tt.wantRequestId {
+				t.Errorf("expected RequestId %q, got %q", tt.wantRequestId, record.RequestId)
+			}
+			if record.Attempts != tt.wantAttempts {
+				t.Errorf("expected %d attempts, got %d", tt.wantAttempts, record.Attempts)
+			}
+			if (len(record.Error) != 0) != tt.wantError {
+				t.Errorf("expected error %v, got %q", tt.wantError, record.Error)
+			}
+			if record.RequestSize == 0 || (!tt.wantError && record.ResponseSize == 0) {
+				t.Errorf("expected the envelope sizes, got %d sent and %d received", record.RequestSize, record.ResponseSize)
+			}
+			if (record.Saved > 0) != tt.wantSaved {
+				t.Errorf("expected saved %v, got %d bytes", tt.wantSaved, record.Saved)
+			}
+		})
+	}
+}
+
+func TestTracerFlush(t *testing.T) {
+	var buf bytes.Buffer
+	tracer, err := NewTracer(&buf, TraceJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := []struct {
+		method   string
+		attempts []attempt
+	}{
+		{method: http.MethodGet, attempts: []attempt{succeeded}},
+		{method: http.MethodGet, attempts: []attempt{unavailable, succeeded}},
+		{method: http.MethodGet, attempts: []attempt{succeeded}},
+		{method: http.MethodGet, attempts: []attempt{succeeded}},
+		{method: http.MethodGet, attempts: []attempt{succeeded}},
+		{method: http.MethodDelete, attempts: []attempt{invalid}},
+	}
+	for _, call := range calls {
+		sendTraced(t, tracedTransport(tracer, &scriptedProcessor{attempts: call.attempts}), call.method, "/api/v1/namespaces/default/pods/web")
+	}
+	if err = tracer.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var summary struct {
+		Kind    string          `json:"kind"`
+		Verbs   []*traceSummary `json:"verbs"`
+		Total   *traceSummary   `json:"total"`
+		Slowest []*traceRecord  `json:"slowest"`
+	}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		summary.Kind = ""
+		if err = json.Unmarshal(scanner.Bytes(), &summary); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if summary.Kind != "summary" {
+		t.Fatalf("expected the summary last, got %s", buf.String())
+	}
+	tests := []struct {
+		verb                      string
+		requests, errors, retries int
+	}{
+		{verb: http.MethodDelete, requests: 1, errors: 1},
+		{verb: http.MethodGet, requests: 5, retries: 1},
+		{verb: "TOTAL", requests: 6, errors: 1, retries: 1},
+	}
+	rows := append(summary.Verbs, summary.Total)
+	if len(rows) != len(tests) {
+		t.Fatalf("expected %d rows, got %d", len(tests), len(rows))
+	}
+	for i, tt := range tests {
+		t.Run(tt.verb, func(t *testing.T) {
+			row := rows[i]
+			if row.Verb != tt.verb || row.Requests != tt.requests || row.Errors != tt.errors || row.Retries != tt.retries {
+				t.Errorf("expected %s with %d requests, %d errors and %d retries, got %+v", tt.verb, tt.requests, tt.errors, tt.retries, row)
+			}
+		})
+	}
+	if len(summary.Slowest) != slowestRequests {
+		t.Errorf("expected the %d slowest requests, got %d", slowestRequests, len(summary.Slowest))
+	}
+	for i := 1; i < len(summary.Slowest); i++ {
+		if summary.Slowest[i].LatencyMs > summary.Slowest[i-1].LatencyMs {
+			t.Errorf("expected the slowest requests first, got %v after %v", summary.Slowest[i].LatencyMs, summary.Slowest[i-1].LatencyMs)
+		}
+	}
+}
+
+func TestTracerText(t *testing.T) {
+	var buf bytes.Buffer
+	tracer, err := NewTracer(&buf, TraceText)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rt := tracedTransport(tracer, &scriptedProcessor{attempts: []attempt{throttled, succeeded}})
+	sendTraced(t, rt, http.MethodGet, "/api/v1/namespaces/default/pods")
+	if err = tracer.Flush(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	for _, want := range []string{"TIME", "GET", "200", "/api/v1/namespaces/default/pods", "RequestId=ok"} {
+		if !strings.Contains(lines[0]+lines[1], want) {
+			t.Errorf("expected the header and request line to contain %q, got %s", want, buf.String())
+		}
+	}
+	if fields := strings.Fields(lines[1]); len(fields) < 8 || fields[7] != "2" {
+		t.Errorf("expected 2 tries, got %q", lines[1])
+	}
+	if !strings.Contains(buf.String(), "TOTAL") {
+		t.Errorf("expected a summary, got %s", buf.String())
+	}
+}
+
+func TestNewTracerFormat(t *testing.T) {
+	if _, err := NewTracer(&bytes.Buffer{}, "yaml"); err == nil || !strings.Contains(err.Error(), "unknown trace format") {
+		t.Errorf("expected an unknown trace format error, got %v", err)
+	}
+}
@@ -1,56 +1,188 @@
 package proxy
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk"
+	sdkerrors "github.com/aliyun/alibaba-cloud-sdk-go/sdk/errors"
 	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/requests"
+	"github.com/aliyun/alibaba-cloud-sdk-go/sdk/responses"
 	knet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/transport"
 )
 
+// Processor sends POP requests, *sdk.Client talks to SAE while Recorder and Replayer work with cassettes.
+type Processor interface {
+	ProcessCommonRequest(request *requests.CommonRequest) (*responses.CommonResponse, error)
+}
+
+var _ Processor = &sdk.Client{}
+
+// ContextProcessor is a Processor that stops working on a request once its context is done, e.g. between retries.
+type ContextProcessor interface {
+	Processor
+	ProcessCommonRequestWithContext(ctx context.Context, request *requests.CommonRequest) (*responses.CommonResponse, error)
+}
+
+// ProcessWithContext sends request with processor and returns the error of ctx once it is done.
+// The SDK can't abort a call, so a plain Processor is left running in the background,
+// with its read timeout bounded by the deadline of ctx.
+func ProcessWithContext(ctx context.Context, processor Processor, request *requests.CommonRequest) (*responses.CommonResponse, error) {
+	if p, ok := processor.(ContextProcessor); ok {
+		return p.ProcessCommonRequestWithContext(ctx, request)
+	}
+	if ctx.Done() == nil {
+		return processor.ProcessCommonRequest(request)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		request.SetReadTimeout(timeout)
+		if connectTimeout := request.GetConnectTimeout(); connectTimeout == 0 || connectTimeout > timeout {
+			request.SetConnectTimeout(timeout)
+		}
+	}
+	type result struct {
+		response *responses.CommonResponse
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := processor.ProcessCommonRequest(request)
+		done <- result{response: response, err: err}
+	}()
+	select {
+	case r := <-done:
+		// a read timeout hit at the deadline is reported as the deadline
+		if r.err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return r.response, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 type Transport struct {
-	proxy    *sdk.Client
+	proxy    Processor
 	delegate http.RoundTripper
+
+	// requestInjectors and responseInjectors run after the built-in ones, so they may override them
+	requestInjectors  []RequestInjector
+	responseInjectors []ResponseInjector
+	compression       *Compression
 }
 
 var _ http.RoundTripper = &Transport{}
 var _ knet.RoundTripperWrapper = &Transport{}
 
-func NewTransportWrapper(cli *sdk.Client) transport.WrapperFunc {
+// TransportOption customizes the envelope pipeline of a Transport.
+type TransportOption func(t *Transport)
+
+// WithRequestInjectors adds injectors that edit the POP request, e.g. to override its metadata or sign it differently.
+func WithRequestInjectors(injectors ...RequestInjector) TransportOption {
+	return func(t *Transport) {
+		t.requestInjectors = append(t.requestInjectors, injectors...)
+	}
+}
+
+// WithResponseInjectors adds injectors that edit the unwrapped Kubernetes response.
+func WithResponseInjectors(injectors ...ResponseInjector) TransportOption {
+	return func(t *Transport) {
+		t.responseInjectors = append(t.responseInjectors, injectors...)
+	}
+}
+
+// WithCompression shares the negotiated compression among transports, by default each transport negotiates on its own.
+func WithCompression(compression *Compression) TransportOption {
+	return func(t *Transport) {
+		t.compression = compression
+	}
+}
+
+func NewTransportWrapper(cli Processor, opts ...TransportOption) transport.WrapperFunc {
 	return func(rt http.RoundTripper) http.RoundTripper {
-		return NewTransport(rt, cli)
+		return NewTransport(rt, cli, opts...)
 	}
 }
 
-func NewTransport(rt http.RoundTripper, cli *sdk.Client) http.RoundTripper {
-	return &Transport{
-		proxy:    cli,
-		delegate: rt,
+// NewTransport sends Kubernetes requests through VirtualServerProxy with cli, e.g.
+//
+//	rt := proxy.NewTransport(http.DefaultTransport, sdkClient,
+//		proxy.WithRequestInjectors(proxy.APIVersionInjector{Version: "2019-05-06"}),
+//		proxy.WithResponseInjectors(proxy.ResponseInjectorFunc(observe)))
+func NewTransport(rt http.RoundTripper, cli Processor, opts ...TransportOption) http.RoundTripper {
+	t := &Transport{
+		proxy:       cli,
+		delegate:    rt,
+		compression: &Compression{},
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	return t
 }
 
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	requestInjector := HttpRequestInjector{Request: req}
+	requestInjector := HttpRequestInjector{Request: req, Compression: t.compression}
 	popReq := requests.NewCommonRequest()
-	if err := warpRequest(popReq,
-		MetaRequestInjector{},
-		requestInjector); err != nil {
+	injectors := append([]RequestInjector{MetaRequestInjector{}, requestInjector}, t.requestInjectors...)
+	if err := warpRequest(popReq, injectors...); err != nil {
 		return nil, err
 	}
-	CommonResponse, err := t.proxy.ProcessCommonRequest(popReq)
+	// compressed last, so the injectors see the plain content
+	saved, err := t.compression.compressRequest(popReq)
 	if err != nil {
 		return nil, err
 	}
+	trace := RequestTraceFrom(req.Context())
+	if trace != nil {
+		trace.RequestSize = len(popReq.GetContent())
+		trace.Saved = saved
+	}
+	CommonResponse, err := ProcessWithContext(req.Context(), t.proxy, popReq)
+	if trace != nil && CommonResponse != nil {
+		trace.ResponseSize = len(CommonResponse.GetHttpContentBytes())
+	}
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, fmt.Errorf("fail to proxy %s %s: %w", req.Method, req.URL.Path, ctxErr)
+		}
+		var serverErr *sdkerrors.ServerError
+		if !errors.As(err, &serverErr) {
+			return nil, err
+		}
+		if trace != nil {
+			trace.RequestId = serverErr.RequestId()
+		}
+		// discovery takes a 403 of its root paths for a server without API groups, so denials stay errors there
+		if req.URL.Path == "/api" || req.URL.Path == "/apis" {
+			return nil, errors.New(statusForServerError(req.Method, serverErr).Message)
+		}
+		response := new(http.Response)
+		if err = wrapResponse(response,
+			append([]ResponseInjector{requestInjector, ServerErrorInjector{serverErr}}, t.responseInjectors...)...); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
 	response := new(http.Response)
 	if err = wrapResponse(response,
-		requestInjector,
-		HttpResponseInjector{CommonResponse}); err != nil {
+		append([]ResponseInjector{requestInjector, HttpResponseInjector{CommonResponse: CommonResponse, Compression: t.compression}}, t.responseInjectors...)...); err != nil {
 		return nil, err
 	}
 	return response, nil
 }
 
+// CancelRequest is a no-op, requests are cancelled through their context.
+func (t *Transport) CancelRequest(req *http.Request) {}
+
 func (t *Transport) WrappedRoundTripper() http.RoundTripper {
 	return t.delegate
 }
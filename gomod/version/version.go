@@ -1,7 +1,17 @@
 package version
 
+import (
+	"fmt"
+	"runtime"
+)
+
 // GitRevision is the commit of repo
 var GitRevision = "UNKNOWN"
 
 // SaeCtlVersion is the version of cli.
 var SaeCtlVersion = "UNKNOWN"
+
+// UserAgent identifies saectl in requests, e.g. saectl/v1.0.0 (linux/amd64) git-abc1234.
+func UserAgent() string {
+	return fmt.Sprintf("saectl/%s (%s/%s) %s", SaeCtlVersion, runtime.GOOS, runtime.GOARCH, GitRevision)
+}